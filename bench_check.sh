@@ -0,0 +1,76 @@
+#!/bin/sh
+#
+# Runs the scrape benchmarks and fails if a scrape allocates more than
+# THRESHOLD percent (10 by default) above the baseline checked in as
+# internal/collector/testdata/bench_baseline.txt. Allocations, unlike
+# latency, do not depend on the machine running the benchmarks. Latency
+# can be checked as well on the machine that recorded the baseline, by
+# setting METRICS to "ns/op B/op allocs/op".
+#
+# Run with -update to record a new baseline, once a change of the
+# results is intended.
+
+set -e
+
+cd "$(dirname "$0")"
+baseline=internal/collector/testdata/bench_baseline.txt
+threshold=${THRESHOLD:-10}
+metrics=${METRICS:-"B/op allocs/op"}
+
+results=$(mktemp)
+trap 'rm -f "$results"' EXIT
+go test -run='^$' -bench=Scrape -benchmem -count=5 ./internal/collector |
+	grep -E '^(goos|goarch|cpu|Benchmark)' > "$results"
+
+if [ "$1" = "-update" ]; then
+	cp "$results" "$baseline"
+	exit 0
+fi
+
+# The best result of every run is compared, as noise only makes
+# benchmarks slower.
+awk -v threshold="$threshold" -v metrics="$metrics" '
+function record(best,    name, i, key) {
+	name = $1
+	sub(/-[0-9]+$/, "", name)
+	for (i = 3; i < NF; i += 2) {
+		key = name " " $(i + 1)
+		if (!(key in best) || $i + 0 < best[key])
+			best[key] = $i + 0
+	}
+}
+BEGIN {
+	n = split(metrics, list, " ")
+	for (i = 1; i <= n; i++)
+		checked[list[i]] = 1
+}
+!/^Benchmark/ { next }
+FILENAME == ARGV[1] { record(base); next }
+{ record(current) }
+END {
+	failed = 0
+	for (key in base) {
+		split(key, parts, " ")
+		if (!(parts[2] in checked))
+			continue
+		if (!(key in current)) {
+			printf "%s: missing from the results\n", key
+			failed = 1
+			continue
+		}
+		change = base[key] ? (current[key] - base[key]) * 100 / base[key] : 0
+		status = ""
+		if (change > threshold) {
+			status = ", regressed"
+			failed = 1
+		}
+		printf "%s: %g -> %g (%+.1f%%%s)\n", key, base[key], current[key], change, status
+		recorded = 1
+	}
+	if (!recorded) {
+		print "No baseline recorded, run with -update"
+		failed = 1
+	}
+	exit failed
+}
+' "$baseline" "$results"
@@ -1,6 +1,6 @@
 #!/bin/sh
 
-docker run -i -v `pwd`:/gopath/src/github.com/kumina/libvirt_exporter alpine:3.8 /bin/sh << 'EOF'
+docker run -i -v `pwd`:/gopath/src/github.com/priteau/libvirt_exporter alpine:3.8 /bin/sh << 'EOF'
 set -ex
 
 # Install prerequisites for the build process.
@@ -28,9 +28,9 @@ make install
 sed -i 's/^Libs:.*/& -lnl -ltirpc -lxml2/' /usr/local/lib/pkgconfig/libvirt.pc
 
 # Build the libvirt_exporter.
-cd /gopath/src/github.com/kumina/libvirt_exporter
+cd /gopath/src/github.com/priteau/libvirt_exporter
 export GOPATH=/gopath
 go get -d ./...
-go build --ldflags '-extldflags "-static"'
+go build --ldflags '-extldflags "-static"' ./cmd/libvirt_exporter
 strip libvirt_exporter
 EOF
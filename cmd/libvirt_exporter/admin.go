@@ -0,0 +1,80 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/priteau/libvirt_exporter/internal/collector"
+)
+
+// maintenancePath is the path of the endpoint used to inspect and toggle
+// the maintenance mode of the host.
+const maintenancePath = "/-/maintenance"
+
+// selectExporters returns the exporters selected by the "uri" form value
+// of a request, or all exporters if it is not set.
+func selectExporters(exporters []*collector.LibvirtExporter, r *http.Request) []*collector.LibvirtExporter {
+	uri := r.FormValue("uri")
+	if uri == "" {
+		return exporters
+	}
+	for _, e := range exporters {
+		if e.URI() == uri {
+			return []*collector.LibvirtExporter{e}
+		}
+	}
+	return nil
+}
+
+// maintenanceHandler returns an HTTP handler reporting the maintenance
+// mode of hosts on GET and HEAD requests, and setting it on POST requests from the
+// "enabled" form value. Requests apply to the host of the URI given in
+// the "uri" form value, or to all hosts if it is not set.
+func maintenanceHandler(set *exporterSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exporters := set.Exporters()
+		selected := selectExporters(exporters, r)
+		if len(selected) == 0 {
+			http.Error(w, "Unknown URI", http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+			if err != nil {
+				http.Error(w, "Invalid value for enabled: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, e := range selected {
+				e.SetMaintenance(enabled)
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(exporters) == 1 {
+			fmt.Fprintf(w, "maintenance=%t\n", selected[0].Maintenance())
+			return
+		}
+		for _, e := range selected {
+			fmt.Fprintf(w, "uri=%q maintenance=%t\n", e.URI(), e.Maintenance())
+		}
+	})
+}
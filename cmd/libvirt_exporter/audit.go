@@ -0,0 +1,131 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// auditLog records the requests made to the administrative endpoints,
+// which can change the state of the exporter or reveal the configuration
+// of domains. Every request is counted, and, if a file is configured,
+// appended to it as a JSON object on its own line, including requests
+// that failed to authenticate.
+type auditLog struct {
+	requests *prometheus.CounterVec
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// auditEntry is an entry of the audit log.
+type auditEntry struct {
+	Time       time.Time           `json:"time"`
+	Identity   string              `json:"identity"`
+	RemoteAddr string              `json:"remote_addr"`
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	Params     map[string][]string `json:"params,omitempty"`
+	Status     int                 `json:"status"`
+}
+
+type auditEntryKey struct{}
+
+// newAuditLog returns an audit log appending to the file at path, or only
+// counting requests if path is empty.
+func newAuditLog(path string) (*auditLog, error) {
+	a := &auditLog{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "libvirt_exporter",
+				Name:      "admin_requests_total",
+				Help:      "Number of requests made to the administrative endpoints, by endpoint, identity of the token and HTTP status code.",
+			},
+			[]string{"endpoint", "identity", "code"}),
+	}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		a.w = file
+	}
+	return a, nil
+}
+
+// setIdentity records the identity of the token that authenticated a
+// request in its audit entry, if it is audited.
+func setIdentity(r *http.Request, identity string) {
+	if entry, ok := r.Context().Value(auditEntryKey{}).(*auditEntry); ok {
+		entry.Identity = identity
+	}
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// wrap wraps the HTTP handler of an administrative endpoint, recording
+// every request made to it once it has been served.
+func (a *auditLog) wrap(endpoint string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &auditEntry{
+			Time:       time.Now(),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(context.WithValue(r.Context(), auditEntryKey{}, entry))
+		handler.ServeHTTP(recorder, r)
+		entry.Status = recorder.status
+		// Form values are only parsed by handlers that use them, and
+		// only after authentication.
+		if entry.Identity != "" {
+			entry.Params = r.Form
+		}
+
+		a.requests.WithLabelValues(endpoint, entry.Identity, strconv.Itoa(entry.Status)).Inc()
+		if a.w == nil {
+			return
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("Failed to encode audit log entry: %s", err)
+			return
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if _, err := a.w.Write(append(data, '\n')); err != nil {
+			log.Printf("Failed to write audit log entry: %s", err)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v2"
+
+	"github.com/priteau/libvirt_exporter/internal/collector"
+)
+
+// settings holds the options of the exporters that can be set either with
+// flags or in the file given with --config.file, whose settings override
+// those of flags. Unlike the options of the web server, they can be
+// reloaded without restarting the exporter.
+type settings struct {
+	URIs                  []string          `yaml:"uris"`
+	ExportNovaMetadata    bool              `yaml:"export_nova_metadata"`
+	ExportNanoseconds     bool              `yaml:"export_nanoseconds"`
+	BlockSourceLabel      string            `yaml:"block_source_label"`
+	SwtpmStateDir         string            `yaml:"swtpm_state_dir"`
+	ExportVolumes         bool              `yaml:"export_storage_volumes"`
+	ExportNWFilters       bool              `yaml:"export_nwfilter_rules"`
+	ExportBlockIoTune     bool              `yaml:"export_block_iotune"`
+	DomainFilter          string            `yaml:"domain_filter"`
+	DomainUUIDFile        string            `yaml:"domain_uuid_file"`
+	IncludeInactive       bool              `yaml:"include_inactive"`
+	WatchDomainEvents     bool              `yaml:"watch_domain_events"`
+	CgroupFallback        bool              `yaml:"cgroup_fallback"`
+	ResolveHostDevices    bool              `yaml:"resolve_host_devices"`
+	SecurityAuditLog      string            `yaml:"security_audit_log"`
+	BackupNamespace       string            `yaml:"backup_metadata_namespace"`
+	ExportCheckpoints     bool              `yaml:"export_checkpoints"`
+	ExportPendingReboot   bool              `yaml:"export_pending_reboot"`
+	ExportGuestDisks      bool              `yaml:"export_guest_disks"`
+	MaxConcurrentCollects int               `yaml:"max_concurrent_collects"`
+	BreakerThreshold      int               `yaml:"breaker_threshold"`
+	BreakerCooldown       string            `yaml:"breaker_cooldown"`
+	Collectors            map[string]bool   `yaml:"collectors"`
+	CollectorIntervals    map[string]string `yaml:"collector_intervals"`
+	LabelMappings         labelMappings     `yaml:"label_mappings"`
+}
+
+// labelMappings renames and drops the labels attached to all metrics of a
+// domain.
+type labelMappings struct {
+	Rename map[string]string `yaml:"rename"`
+	Drop   []string          `yaml:"drop"`
+}
+
+// withFile returns the settings overridden by those of a configuration
+// file. Settings that are absent from the file are left unchanged.
+func (s settings) withFile(path string) (settings, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	// Maps are merged by the decoder, so they are copied to leave the
+	// settings of flags untouched across reloads.
+	collectors := map[string]bool{}
+	for name, enabled := range s.Collectors {
+		collectors[name] = enabled
+	}
+	intervals := map[string]string{}
+	for name, interval := range s.CollectorIntervals {
+		intervals[name] = interval
+	}
+	renames := map[string]string{}
+	for label, name := range s.LabelMappings.Rename {
+		renames[label] = name
+	}
+	s.Collectors, s.CollectorIntervals, s.LabelMappings.Rename = collectors, intervals, renames
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// options returns the options of the exporters described by the
+// settings, with a logger, a connection pool, a host limiter and a tracer
+// shared by all of them.
+func (s settings) options(logger *collector.ThrottledLogger, pool *collector.ConnPool, hosts *collector.HostLimiter, tracer trace.Tracer) (collector.LibvirtExporterOptions, error) {
+	opts := collector.LibvirtExporterOptions{
+		ExportNovaMetadata:    s.ExportNovaMetadata,
+		ExportNanoseconds:     s.ExportNanoseconds,
+		BlockSourceLabel:      s.BlockSourceLabel,
+		Logger:                logger,
+		Pool:                  pool,
+		SwtpmStateDir:         s.SwtpmStateDir,
+		ExportVolumes:         s.ExportVolumes,
+		ExportNWFilters:       s.ExportNWFilters,
+		ExportBlockIoTune:     s.ExportBlockIoTune,
+		CollectorIntervals:    map[string]time.Duration{},
+		IncludeInactive:       s.IncludeInactive,
+		WatchDomainEvents:     s.WatchDomainEvents,
+		CgroupFallback:        s.CgroupFallback,
+		ResolveHostDevices:    s.ResolveHostDevices,
+		SecurityAuditLog:      s.SecurityAuditLog,
+		BackupNamespace:       s.BackupNamespace,
+		ExportCheckpoints:     s.ExportCheckpoints,
+		ExportPendingReboot:   s.ExportPendingReboot,
+		ExportGuestDisks:      s.ExportGuestDisks,
+		DisabledCollectors:    map[string]bool{},
+		DomainLabelRenames:    s.LabelMappings.Rename,
+		DroppedDomainLabels:   map[string]bool{},
+		MaxConcurrentCollects: s.MaxConcurrentCollects,
+		BreakerThreshold:      s.BreakerThreshold,
+		HostLimiter:           hosts,
+		ConfigHash:            s.hash(),
+		Tracer:                tracer,
+	}
+	if s.BreakerThreshold > 0 {
+		cooldown, err := time.ParseDuration(s.BreakerCooldown)
+		if err != nil {
+			return opts, fmt.Errorf("invalid circuit breaker cooldown: %s", err)
+		}
+		opts.BreakerCooldown = cooldown
+	}
+	for name, value := range s.CollectorIntervals {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid interval of collector %s: %s", name, err)
+		}
+		opts.CollectorIntervals[name] = interval
+	}
+	for name, enabled := range s.Collectors {
+		if !enabled {
+			opts.DisabledCollectors[name] = true
+		}
+	}
+	for _, label := range s.LabelMappings.Drop {
+		opts.DroppedDomainLabels[label] = true
+	}
+
+	if s.DomainFilter != "" {
+		// Filters must match the whole name of domains.
+		domainFilter, err := regexp.Compile("^(?:" + s.DomainFilter + ")$")
+		if err != nil {
+			return opts, fmt.Errorf("invalid domain filter: %s", err)
+		}
+		opts.DomainFilter = domainFilter
+	}
+	if s.DomainUUIDFile != "" {
+		domainUUIDs, err := collector.NewUUIDAllowlist(s.DomainUUIDFile)
+		if err != nil {
+			return opts, fmt.Errorf("failed to read domain UUID file: %s", err)
+		}
+		opts.DomainUUIDs = domainUUIDs
+	}
+	return opts, nil
+}
+
+// hash returns a short hash of the settings, which differs between hosts
+// whose settings differ in any way.
+func (s settings) hash() string {
+	// Maps are marshalled with sorted keys, so the hash is stable.
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
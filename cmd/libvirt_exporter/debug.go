@@ -0,0 +1,108 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// debugDomainPrefix is the path under which the debug endpoints for
+// individual domains are served, as /debug/domain/<name>/xml and
+// /debug/domain/<name>/guest-disks.
+const debugDomainPrefix = "/debug/domain/"
+
+// readTokenFile reads the bearer tokens stored in a file, one per line,
+// and returns the identities they are known by in the audit log. Lines
+// may either hold a token alone, known by defaultIdentity, or an identity
+// followed by its token. Empty lines and lines starting with # are
+// ignored.
+func readTokenFile(path, defaultIdentity string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+		case len(fields) == 1:
+			tokens[fields[0]] = defaultIdentity
+		case len(fields) == 2:
+			tokens[fields[1]] = fields[0]
+		default:
+			return nil, fmt.Errorf("invalid line in token file %s, expected an identity and a token", path)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("token file %s is empty", path)
+	}
+	return tokens, nil
+}
+
+// requireToken wraps an HTTP handler, only letting through requests that
+// carry one of the provided bearer tokens in their Authorization header.
+// The identity of the token is recorded in the audit log.
+func requireToken(tokens map[string]string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		// All tokens are compared, so that the time taken does not
+		// reveal which of them matched.
+		identity := ""
+		for token, name := range tokens {
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+				identity = name
+			}
+		}
+		if identity == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		setIdentity(r, identity)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// domainDebugHandler returns an HTTP handler serving the debug endpoints
+// of the URI given in the "uri" query parameter, or of the first URI if it
+// is not set.
+func domainDebugHandler(set *exporterSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exporters := set.Exporters()
+		selected := selectExporters(exporters, r)
+		if len(selected) == 0 {
+			http.Error(w, "Unknown URI", http.StatusNotFound)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, debugDomainPrefix)
+		i := strings.LastIndex(path, "/")
+		if i <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		switch domainName, endpoint := path[:i], path[i+1:]; endpoint {
+		case "xml":
+			selected[0].ServeDomainXML(w, domainName)
+		case "guest-disks":
+			selected[0].ServeDomainGuestDisks(w, domainName)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
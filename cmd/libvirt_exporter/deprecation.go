@@ -0,0 +1,109 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/priteau/libvirt_exporter/internal/collector"
+)
+
+// deprecationWarnings marks the deprecated metric families in the help of
+// their metrics and, if enabled, reports the number of series of every
+// deprecated family in the last response of the metrics endpoint, logging
+// a warning for those that are still exported, so that their users can
+// be found before they are removed.
+type deprecationWarnings struct {
+	deprecations map[string]collector.Deprecation
+	// logger is nil when warnings are disabled.
+	logger *collector.ThrottledLogger
+
+	seriesDesc *prometheus.Desc
+
+	mu     sync.Mutex
+	series map[string]int
+}
+
+func newDeprecationWarnings(deprecations map[string]collector.Deprecation, logger *collector.ThrottledLogger) *deprecationWarnings {
+	return &deprecationWarnings{
+		deprecations: deprecations,
+		logger:       logger,
+		seriesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt_exporter", "", "deprecated_series"),
+			"Number of series of a deprecated metric family in the last response of the metrics endpoint, with the family replacing it and the release removing it, if known.",
+			[]string{"family", "replacement", "removal"},
+			nil),
+	}
+}
+
+// deprecationDetails describes the replacement and removal of a deprecated
+// family, such as ", use libvirt_domain_x instead, to be removed in 2.0".
+func deprecationDetails(deprecation collector.Deprecation) string {
+	details := ""
+	if deprecation.Replacement != "" {
+		details += ", use " + deprecation.Replacement + " instead"
+	}
+	if deprecation.Removal != "" {
+		details += ", to be removed in " + deprecation.Removal
+	}
+	return details
+}
+
+// Describe implements prometheus.Collector.
+func (d *deprecationWarnings) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.seriesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (d *deprecationWarnings) Collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for family, series := range d.series {
+		deprecation := d.deprecations[family]
+		ch <- prometheus.MustNewConstMetric(d.seriesDesc, prometheus.GaugeValue, float64(series), family, deprecation.Replacement, deprecation.Removal)
+	}
+}
+
+// gatherer wraps a gatherer, marking the deprecated metric families it
+// returns and, if warnings are enabled, recording their number of series.
+func (d *deprecationWarnings) gatherer(gatherer prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := gatherer.Gather()
+		series := map[string]int{}
+		for _, family := range families {
+			deprecation, ok := d.deprecations[family.GetName()]
+			if !ok {
+				continue
+			}
+			help := "Deprecated" + deprecationDetails(deprecation) + ". " + family.GetHelp()
+			family.Help = &help
+			series[family.GetName()] = len(family.Metric)
+		}
+		if d.logger == nil {
+			return families, err
+		}
+		// Warnings are logged on every scrape, relying on the logger to
+		// suppress repeated ones.
+		for family := range series {
+			d.logger.Printf("Metric family %s is still exported, but deprecated%s", family, deprecationDetails(d.deprecations[family]))
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.series = series
+		return families, err
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// expositionStats records the size of the responses of the metrics
+// endpoint and the number of series of every metric family, so that the
+// ingestion cost of a host can be tuned with filters and collectors. As
+// they are only known once metrics have been gathered, the values of the
+// previous scrape are reported.
+type expositionStats struct {
+	bytesDesc  *prometheus.Desc
+	seriesDesc *prometheus.Desc
+
+	mu     sync.Mutex
+	bytes  int
+	series map[string]int
+	// history holds the metrics of the last scrapes, from which reports
+	// and range queries are built.
+	history *snapshotRing
+}
+
+// snapshot holds the metrics returned by a scrape.
+type snapshot struct {
+	time     time.Time
+	families []*dto.MetricFamily
+}
+
+// snapshotRing holds the last snapshots, up to its capacity, replacing
+// the oldest ones.
+type snapshotRing struct {
+	snapshots []*snapshot
+	next      int
+	count     int
+}
+
+func newSnapshotRing(capacity int) *snapshotRing {
+	return &snapshotRing{snapshots: make([]*snapshot, capacity)}
+}
+
+// add records a snapshot, replacing the oldest one if the ring is full.
+func (r *snapshotRing) add(snap *snapshot) {
+	r.snapshots[r.next] = snap
+	r.next = (r.next + 1) % len(r.snapshots)
+	if r.count < len(r.snapshots) {
+		r.count++
+	}
+}
+
+// latest returns the snapshot recorded age snapshots before the last one,
+// or nil if there is none.
+func (r *snapshotRing) latest(age int) *snapshot {
+	if age >= r.count {
+		return nil
+	}
+	return r.snapshots[(r.next-1-age+len(r.snapshots))%len(r.snapshots)]
+}
+
+// all returns the snapshots held by the ring, from the oldest.
+func (r *snapshotRing) all() []*snapshot {
+	snapshots := make([]*snapshot, r.count)
+	for i := range snapshots {
+		snapshots[i] = r.latest(r.count - 1 - i)
+	}
+	return snapshots
+}
+
+// newExpositionStats creates the statistics of the metrics endpoint,
+// keeping the metrics of the given number of scrapes, and of at least
+// the last two.
+func newExpositionStats(historySize int) *expositionStats {
+	if historySize < 2 {
+		historySize = 2
+	}
+	return &expositionStats{
+		history: newSnapshotRing(historySize),
+		bytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt_exporter", "last_scrape", "response_bytes"),
+			"Size of the last response of the metrics endpoint before compression, in bytes.",
+			nil,
+			nil),
+		seriesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt_exporter", "last_scrape", "series"),
+			"Number of series of a metric family in the last response of the metrics endpoint.",
+			[]string{"family"},
+			nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (s *expositionStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.bytesDesc
+	ch <- s.seriesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *expositionStats) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.series == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(s.bytesDesc, prometheus.GaugeValue, float64(s.bytes))
+	for family, series := range s.series {
+		ch <- prometheus.MustNewConstMetric(s.seriesDesc, prometheus.GaugeValue, float64(series), family)
+	}
+}
+
+// gatherer wraps a gatherer, recording the number of series of the metric
+// families it returns.
+func (s *expositionStats) gatherer(gatherer prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := gatherer.Gather()
+		series := make(map[string]int, len(families))
+		for _, family := range families {
+			series[family.GetName()] = len(family.Metric)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.series = series
+		s.history.add(&snapshot{time: time.Now(), families: families})
+		return families, err
+	})
+}
+
+// record adds metrics gathered outside of scrapes to the history,
+// leaving the statistics of the last scrape unchanged.
+func (s *expositionStats) record(families []*dto.MetricFamily) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history.add(&snapshot{time: time.Now(), families: families})
+}
+
+// snapshots returns the metrics of the last two scrapes. last is nil until
+// metrics have been scraped, and previous until they have been scraped
+// twice.
+func (s *expositionStats) snapshots() (last, previous *snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history.latest(0), s.history.latest(1)
+}
+
+// allSnapshots returns the metrics of all the scrapes held, from the
+// oldest.
+func (s *expositionStats) allSnapshots() []*snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history.all()
+}
+
+// countingResponseWriter counts the bytes written to the body of a
+// response.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	bytes int
+}
+
+func (w *countingResponseWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
+
+// handler wraps the HTTP handler of the metrics endpoint, recording the
+// size of its responses.
+func (s *expositionStats) handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &countingResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(counter, r)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bytes = counter.bytes
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// healthyPath is the path of the liveness endpoint, which succeeds
+	// as long as the exporter serves HTTP requests.
+	healthyPath = "/-/healthy"
+	// readyPath is the path of the readiness endpoint, which succeeds
+	// once the exporter has connected to libvirt, and optionally once it
+	// has warmed up.
+	readyPath = "/-/ready"
+)
+
+// healthyHandler returns an HTTP handler reporting that the exporter is
+// alive.
+func healthyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Healthy\n")
+	})
+}
+
+// readyHandler returns an HTTP handler reporting whether the exporters of
+// all URIs have connected to libvirt and, if warmedUp is not nil, whether
+// it was closed once the exporters were warmed up at startup. Once ready,
+// an exporter remains so even if libvirt becomes unreachable, which is
+// reported by libvirt_up instead, so that the exporter is not removed from
+// service discovery while libvirtd restarts.
+func readyHandler(set *exporterSet, warmedUp <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if warmedUp != nil {
+			select {
+			case <-warmedUp:
+			default:
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "Warming up\n")
+				return
+			}
+		}
+		exporters := set.Exporters()
+		var notReady []string
+		for _, e := range exporters {
+			if !e.Ready() {
+				notReady = append(notReady, e.URI())
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(notReady) == 0 {
+			fmt.Fprintf(w, "Ready\n")
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, uri := range notReady {
+			fmt.Fprintf(w, "Not connected to %s\n", uri)
+		}
+	})
+}
+
+// serve serves HTTP requests on the listener until the exporter receives
+// SIGINT or SIGTERM. It then stops accepting connections, and waits for
+// up to shutdownTimeout for requests in progress to complete.
+func serve(server *http.Server, listener net.Listener, shutdownTimeout time.Duration) error {
+	shutdownErr := make(chan error, 1)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("Received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdownErr <- server.Shutdown(ctx)
+	}()
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdownErr
+}
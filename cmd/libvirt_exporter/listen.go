@@ -0,0 +1,69 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// sdListenFdsStart is the first file descriptor passed by systemd socket
+// activation, see sd_listen_fds(3).
+const sdListenFdsStart = 3
+
+// listen returns the socket on which the web interface is served. A
+// socket passed by systemd socket activation is used if there is one, so
+// that systemd keeps accepting connections while the exporter restarts.
+// Otherwise, a socket is created on the provided address. With reusePort,
+// it is created with SO_REUSEPORT, which allows a new instance of the
+// exporter to start listening before the old one stops.
+func listen(address string, reusePort bool) (net.Listener, error) {
+	listener, err := systemdListener()
+	if listener != nil || err != nil {
+		return listener, err
+	}
+
+	var config net.ListenConfig
+	if reusePort {
+		config.Control = setReusePort
+	}
+	return config.Listen(context.Background(), "tcp", address)
+}
+
+// systemdListener returns the socket passed by systemd socket activation,
+// or nil if there is none.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds == 0 {
+		return nil, nil
+	}
+	if fds != 1 {
+		return nil, fmt.Errorf("expected a single socket from systemd, got %d", fds)
+	}
+	// Do not pass the sockets on to child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(sdListenFdsStart, "systemd socket")
+	defer file.Close()
+	return net.FileListener(file)
+}
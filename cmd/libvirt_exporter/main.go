@@ -0,0 +1,379 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command libvirt_exporter exports the metrics of libvirt hosts and of
+// their domains to Prometheus.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/priteau/libvirt_exporter/internal/collector"
+)
+
+func main() {
+	var (
+		app                       = kingpin.New("libvirt_exporter", "Prometheus metrics exporter for libvirt")
+		listenAddress             = app.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9177").String()
+		reusePort                 = app.Flag("web.reuse-port", "Listen with SO_REUSEPORT, so that a new instance of the exporter can start listening before the old one stops.").Default("false").Bool()
+		configFile                = app.Flag("config.file", "Path to a YAML file overriding the settings of the libvirt and collector flags. It is reloaded on SIGHUP and on POST requests to "+reloadPath+".").Default("").String()
+		webConfigFile             = app.Flag("web.config.file", "Path to a configuration file that can enable TLS and basic authentication, in the format of the Prometheus exporter toolkit.").Default("").String()
+		readyAfterWarmUp          = app.Flag("web.ready-after-warm-up", "Only report the exporter as ready once the collection of metrics performed at startup to warm it up completes.").Default("false").Bool()
+		shutdownTimeout           = app.Flag("web.shutdown-timeout", "Time to wait for requests in progress to complete when shutting down.").Default("30s").Duration()
+		gzipLevel                 = app.Flag("web.gzip-level", "Compression level of the responses of the metrics endpoint and landing page to clients accepting gzip, from 1 (fastest) to 9 (smallest), -1 for the default level, or 0 to disable compression.").Default("-1").Int()
+		historySize               = app.Flag("web.history-size", "Number of scrapes whose metrics are kept in memory and served on "+rangePath+", or 0 to disable the endpoint.").Default("0").Int()
+		historyInterval           = app.Flag("web.history-interval", "Interval at which metrics are collected to be kept in the history, in addition to scrapes, or 0 to only keep those of scrapes.").Default("0").Duration()
+		metricsPath               = app.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
+		libvirtURIs               = app.Flag("libvirt.uri", "Libvirt URI from which to extract metrics. Can be repeated, or hold a comma-separated list of URIs.").Default("qemu:///system").Strings()
+		libvirtStartupRetries     = app.Flag("libvirt.startup-retries", "Number of times connecting to libvirt is retried at startup before exiting, or 0 not to check the connection at startup.").Default("0").Int()
+		libvirtStartupBackoff     = app.Flag("libvirt.startup-backoff", "Delay before the first retry of connecting to libvirt at startup, doubled after every attempt.").Default("1s").Duration()
+		libvirtExportNovaMetadata = app.Flag("libvirt.export-nova-metadata", "Export OpenStack Nova specific labels from libvirt domain xml").Default("false").Bool()
+		libvirtLabelRenames       = app.Flag("libvirt.label-rename", "Export a label attached to all metrics of a domain (domain, resource_id, and the Nova labels) under another name, as <label>=<name>. Can be repeated.").StringMap()
+		libvirtLabelDrops         = app.Flag("libvirt.label-drop", "Do not export a label attached to all metrics of a domain, other than domain. Can be repeated.").Strings()
+		libvirtBlockSourceLabel   = app.Flag("libvirt.block-source-label", "Disk attribute used as the source_file label of block device metrics: "+strings.Join(collector.BlockSourceLabels, ", ")+".").Default("file").Enum(collector.BlockSourceLabels...)
+		libvirtExportNanoseconds  = app.Flag("libvirt.export-nanoseconds", "Export timing counters in nanoseconds, as reported by libvirt, in addition to seconds").Default("false").Bool()
+		deprecationWarnings       = app.Flag("web.deprecation-warnings", "Report the number of series of deprecated metric families exported as libvirt_exporter_deprecated_series, and log a warning while they are exported.").Default("false").Bool()
+		includeErrorComments      = app.Flag("web.include-error-comments", "Describe why collecting metrics from libvirt failed in a '# ERROR' comment at the end of the text exposition format.").Default("false").Bool()
+		logThrottleInterval       = app.Flag("log.throttle-interval", "Interval during which identical log messages are suppressed, or 0 to log all messages.").Default("5m").Duration()
+		maintenance               = app.Flag("maintenance", "Start with the host in maintenance mode.").Default("false").Bool()
+		adminTokenFile            = app.Flag("web.admin-token-file", "Enable the "+maintenancePath+" endpoint, protected by the bearer tokens stored in this file, one per line, optionally preceded by the identity recorded in the audit log.").Default("").String()
+		collectorIntervals        = app.Flag("collector.interval", "Collect the metrics of a collector ("+strings.Join(collector.CollectorNames, ", ")+") in the background every given interval, as <collector>=<interval>, instead of on every scrape. Can be repeated.").StringMap()
+		libvirtDomainFilter       = app.Flag("libvirt.domain-filter", "Only collect the metrics of domains whose name matches this regular expression.").Default("").String()
+		domainUUIDFile            = app.Flag("domain.uuid-file", "Only collect the metrics of domains whose UUID is listed in this file, one per line. The file is read again when it changes.").Default("").String()
+		libvirtCgroupFallback     = app.Flag("libvirt.cgroup-fallback", "When libvirt fails to report the CPU time or block statistics of a running domain, read them from the cgroup of the domain instead. Only supported for local URIs on Linux.").Default("false").Bool()
+		libvirtResolveHostDevices = app.Flag("libvirt.resolve-host-devices", "Export the host block devices, such as dm-3, backing the block disks of domains, so that they can be joined with host disk metrics, and the number of paths of multipath devices. Only supported for local URIs.").Default("false").Bool()
+		libvirtSecurityAuditLog   = app.Flag("libvirt.security-audit-log", "Count the AppArmor and SELinux denials of domains logged in this file, such as /var/log/audit/audit.log. Only supported for local URIs.").Default("").String()
+		libvirtBackupNamespace    = app.Flag("libvirt.backup-metadata-namespace", "Namespace of the element of the metadata of domains holding the time of their last successful backup, as Unix seconds or in RFC 3339 format.").Default("").String()
+		libvirtExportCheckpoints  = app.Flag("libvirt.export-checkpoints", "Report the creation time of the latest checkpoint of domains without a backup time in their metadata as the time of their last backup.").Default("false").Bool()
+		libvirtExportGuestDisks   = app.Flag("libvirt.export-guest-disks", "Export the devices the disks of running domains appear as in their guest, as reported by the QEMU guest agent.").Default("false").Bool()
+		libvirtPendingReboot      = app.Flag("libvirt.export-pending-reboot", "Report the changes to the persistent configuration of running domains, such as of their machine type or CPU model, that only take effect once they are restarted.").Default("false").Bool()
+		libvirtWatchDomainEvents  = app.Flag("libvirt.watch-domain-events", "Record the changes of the definition of domains from libvirt events, over an additional connection to every URI.").Default("false").Bool()
+		libvirtIncludeInactive    = app.Flag("libvirt.include-inactive", "Collect the metrics of inactive domains.").Default("true").Bool()
+		libvirtMaxConcurrent      = app.Flag("libvirt.max-concurrent-collects", "Maximum number of domains whose metrics are collected concurrently.").Default("4").Int()
+		libvirtPoolSize           = app.Flag("libvirt.pool-size", "Maximum number of connections to libvirt kept open across scrapes, or 0 to connect on every scrape.").Default("16").Int()
+		libvirtMaxConcurrentHosts = app.Flag("libvirt.max-concurrent-hosts", "Maximum number of libvirt URIs whose metrics are collected concurrently on scrapes, or 0 for no limit.").Default("0").Int()
+		libvirtBreakerThreshold   = app.Flag("libvirt.breaker-threshold", "Number of consecutive failures to connect to a libvirt URI after which connecting to it is skipped for --libvirt.breaker-cooldown, reporting libvirt_up as 0, or 0 to always connect.").Default("0").Int()
+		libvirtBreakerCooldown    = app.Flag("libvirt.breaker-cooldown", "Time during which connecting to a libvirt URI is skipped once --libvirt.breaker-threshold is reached.").Default("1m").Duration()
+		shardIndex                = app.Flag("shard.index", "Index of this exporter among the replicas that split the libvirt URIs between them, from 0 to --shard.total - 1.").Default("0").Int()
+		shardTotal                = app.Flag("shard.total", "Number of exporter replicas that split the libvirt URIs between them.").Default("1").Int()
+		swtpmStateDir             = app.Flag("libvirt.swtpm-state-dir", "Directory in which libvirt stores the sockets and PID files of swtpm processes.").Default("/run/libvirt/qemu/swtpm").String()
+		libvirtExportBlockIoTune  = app.Flag("libvirt.export-block-iotune", "Export the I/O limits of the disks of running domains.").Default("false").Bool()
+		libvirtExportNWFilters    = app.Flag("libvirt.export-nwfilter-rules", "Export the number of rules of the network filters of domain interfaces.").Default("false").Bool()
+		libvirtExportVolumes      = app.Flag("libvirt.export-storage-volumes", "Export the capacity and allocation of every volume of running storage pools.").Default("false").Bool()
+		auditLogFile              = app.Flag("web.audit-log-file", "Append the requests made to the maintenance, reload and debug endpoints to this file, as JSON objects on their own lines.").Default("").String()
+		tracingEndpoint           = app.Flag("tracing.otlp-endpoint", "Send traces of the runs of collectors to this OTLP gRPC endpoint, such as localhost:4317, and attach their trace IDs as exemplars to libvirt_collector_duration_seconds, exposed in the OpenMetrics format.").Default("").String()
+		tracingInsecure           = app.Flag("tracing.otlp-insecure", "Send traces to the OTLP endpoint without TLS.").Default("false").Bool()
+		tracingSampleRatio        = app.Flag("tracing.sample-ratio", "Fraction of the runs of collectors that are traced, from 0 to 1.").Default("1").Float64()
+		debugTokenFile            = app.Flag("web.debug-token-file", "Enable the /debug/domain/<name>/xml and /debug/domain/<name>/guest-disks endpoints, protected by the bearer tokens stored in this file, one per line, optionally preceded by the identity recorded in the audit log.").Default("").String()
+
+		previewCmd  = app.Command("preview", "Print the metrics and labels that would be exported for a domain XML file, without connecting to libvirt.")
+		previewFile = previewCmd.Arg("file", "Domain XML file, as produced by 'virsh dumpxml'.").Required().ExistingFile()
+	)
+	app.Command("serve", "Serve metrics over HTTP.").Default()
+	collectorEnabled := map[string]*bool{}
+	for _, name := range collector.OptionalCollectorNames {
+		enabled := !collector.IsDisabledByDefault(name)
+		collectorEnabled[name] = app.Flag("collector."+name, "Enable the "+name+" collector.").Default(strconv.FormatBool(enabled)).Bool()
+	}
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	flagSettings := settings{
+		URIs:                  *libvirtURIs,
+		ExportNovaMetadata:    *libvirtExportNovaMetadata,
+		ExportNanoseconds:     *libvirtExportNanoseconds,
+		BlockSourceLabel:      *libvirtBlockSourceLabel,
+		SwtpmStateDir:         *swtpmStateDir,
+		ExportVolumes:         *libvirtExportVolumes,
+		ExportNWFilters:       *libvirtExportNWFilters,
+		ExportBlockIoTune:     *libvirtExportBlockIoTune,
+		DomainFilter:          *libvirtDomainFilter,
+		DomainUUIDFile:        *domainUUIDFile,
+		IncludeInactive:       *libvirtIncludeInactive,
+		WatchDomainEvents:     *libvirtWatchDomainEvents,
+		CgroupFallback:        *libvirtCgroupFallback,
+		ResolveHostDevices:    *libvirtResolveHostDevices,
+		SecurityAuditLog:      *libvirtSecurityAuditLog,
+		BackupNamespace:       *libvirtBackupNamespace,
+		ExportCheckpoints:     *libvirtExportCheckpoints,
+		ExportPendingReboot:   *libvirtPendingReboot,
+		ExportGuestDisks:      *libvirtExportGuestDisks,
+		MaxConcurrentCollects: *libvirtMaxConcurrent,
+		BreakerThreshold:      *libvirtBreakerThreshold,
+		BreakerCooldown:       libvirtBreakerCooldown.String(),
+		Collectors:            map[string]bool{},
+		CollectorIntervals:    *collectorIntervals,
+		LabelMappings: labelMappings{
+			Rename: *libvirtLabelRenames,
+			Drop:   *libvirtLabelDrops,
+		},
+	}
+	for name, enabled := range collectorEnabled {
+		flagSettings.Collectors[name] = *enabled
+	}
+	logger := collector.NewThrottledLogger(*logThrottleInterval)
+	pool := collector.NewConnPool(*libvirtPoolSize)
+	hosts := collector.NewHostLimiter(*libvirtMaxConcurrentHosts)
+	tracerProvider, err := newTracerProvider(*tracingEndpoint, *tracingInsecure, *tracingSampleRatio)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %s", err)
+	}
+	var tracer trace.Tracer
+	if tracerProvider != nil {
+		tracer = tracerProvider.Tracer("github.com/priteau/libvirt_exporter")
+	}
+
+	// loadOptions returns the options of the exporters and the URIs to
+	// collect from, from the settings of flags overridden by the
+	// configuration file.
+	loadOptions := func() (collector.LibvirtExporterOptions, []string, error) {
+		s := flagSettings
+		if *configFile != "" {
+			var err error
+			s, err = s.withFile(*configFile)
+			if err != nil {
+				return collector.LibvirtExporterOptions{}, nil, err
+			}
+		}
+		opts, err := s.options(logger, pool, hosts, tracer)
+		return opts, parseURIs(s.URIs), err
+	}
+	// loadExporters creates the exporters of the URIs assigned to this
+	// shard.
+	loadExporters := func() ([]*collector.LibvirtExporter, error) {
+		opts, uris, err := loadOptions()
+		if err != nil {
+			return nil, err
+		}
+		uris, err = shardURIs(uris, *shardIndex, *shardTotal)
+		if err != nil {
+			return nil, err
+		}
+		if len(uris) == 0 {
+			return nil, fmt.Errorf("no libvirt URI is assigned to shard %d of %d", *shardIndex, *shardTotal)
+		}
+		var exporters []*collector.LibvirtExporter
+		for _, uri := range uris {
+			opts.URI = uri
+			exporter, err := collector.NewLibvirtExporter(opts)
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exporter)
+		}
+		return exporters, nil
+	}
+
+	if command == previewCmd.FullCommand() {
+		opts, _, err := loadOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		exporter, err := collector.NewLibvirtExporter(opts)
+		if err != nil {
+			panic(err)
+		}
+		if err := exporter.PreviewDomainFile(os.Stdout, *previewFile); err != nil {
+			log.Fatalf("Failed to preview domain: %s", err)
+		}
+		return
+	}
+
+	// The event loop is always started, so that watching domain events
+	// can be enabled by reloading the configuration.
+	if err := collector.StartEventLoop(); err != nil {
+		log.Fatalf("Failed to start libvirt event loop: %s", err)
+	}
+	exporters, err := loadExporters()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, exporter := range exporters {
+		exporter.SetMaintenance(*maintenance)
+	}
+	set := newExporterSet()
+	if err := set.Replace(exporters); err != nil {
+		log.Fatal(err)
+	}
+	prometheus.MustRegister(logger, pool)
+	// warmUp warms up exporters concurrently, returning once all of them
+	// are.
+	warmUp := func(exporters []*collector.LibvirtExporter) {
+		var wg sync.WaitGroup
+		for _, exporter := range exporters {
+			wg.Add(1)
+			go func(exporter *collector.LibvirtExporter) {
+				defer wg.Done()
+				exporter.WarmUp()
+			}(exporter)
+		}
+		wg.Wait()
+	}
+	// The exporters are warmed up in the background, so that metrics
+	// can be served in the meantime.
+	var warmedUp chan struct{}
+	if *readyAfterWarmUp {
+		warmedUp = make(chan struct{})
+	}
+	go func() {
+		warmUp(exporters)
+		log.Printf("Warm-up completed")
+		if warmedUp != nil {
+			close(warmedUp)
+		}
+	}()
+
+	// The configuration is reloaded on SIGHUP, and on POST requests to
+	// /-/reload. A configuration that fails to load leaves the current
+	// exporters in place.
+	var reloadMu sync.Mutex
+	reload := func() error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		exporters, err := loadExporters()
+		if err != nil {
+			return err
+		}
+		if err := set.Replace(exporters); err != nil {
+			return err
+		}
+		go warmUp(exporters)
+		log.Printf("Configuration reloaded")
+		return nil
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reload(); err != nil {
+				log.Printf("Failed to reload configuration: %s", err)
+			}
+		}
+	}()
+
+	webCfg := &webConfig{}
+	if *webConfigFile != "" {
+		webCfg, err = readWebConfig(*webConfigFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := checkGzipLevel(*gzipLevel); err != nil {
+		log.Fatal(err)
+	}
+	// Responses are compressed by gzipHandler rather than by promhttp, so
+	// that the compression level can be set.
+	exposition := newExpositionStats(*historySize)
+	prometheus.MustRegister(exposition)
+	deprecations := newDeprecationWarnings(collector.DeprecatedFamilies, nil)
+	if *deprecationWarnings {
+		deprecations = newDeprecationWarnings(collector.DeprecatedFamilies, logger)
+		prometheus.MustRegister(deprecations)
+	}
+	// The exporters are registered in a registry of their own, which is
+	// replaced on reload.
+	gatherer := exposition.gatherer(deprecations.gatherer(prometheus.Gatherers{prometheus.DefaultGatherer, set}))
+	// Exemplars are only exposed in the OpenMetrics format.
+	var metricsHandler http.Handler = promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		DisableCompression: true,
+		EnableOpenMetrics:  tracer != nil,
+	})
+	if *includeErrorComments {
+		metricsHandler = errorCommentHandler(gatherer, set, tracer != nil)
+	}
+	metricsHandler = exposition.handler(promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, metricsHandler))
+	// The endpoints protected by a bearer token are left out of basic
+	// authentication, as both use the Authorization header. Dynamic
+	// endpoints must not be cached.
+	http.Handle(*metricsPath, webCfg.requireBasicAuth(cacheControl("no-store", gzipHandler(*gzipLevel, metricsHandler))))
+	http.Handle(reportPath, webCfg.requireBasicAuth(cacheControl("no-store", gzipHandler(*gzipLevel, reportHandler(exposition, set)))))
+	if *historySize > 0 {
+		http.Handle(rangePath, webCfg.requireBasicAuth(cacheControl("no-store", gzipHandler(*gzipLevel, rangeHandler(exposition)))))
+		if *historyInterval > 0 {
+			// The history is recorded from the exporters directly,
+			// so that it does not count as scrapes nor logs
+			// deprecation warnings.
+			go recordHistory(exposition, prometheus.Gatherers{prometheus.DefaultGatherer, set.unscrapedGatherer()}, *historyInterval)
+		}
+	}
+	http.Handle(healthyPath, cacheControl("no-store", healthyHandler()))
+	http.Handle(readyPath, cacheControl("no-store", readyHandler(set, warmedUp)))
+	audit, err := newAuditLog(*auditLogFile)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %s", err)
+	}
+	prometheus.MustRegister(audit.requests)
+	if *adminTokenFile != "" {
+		tokens, err := readTokenFile(*adminTokenFile, "admin")
+		if err != nil {
+			panic(err)
+		}
+		http.Handle(maintenancePath, cacheControl("no-store", audit.wrap("maintenance", requireToken(tokens, maintenanceHandler(set)))))
+		if *configFile != "" {
+			http.Handle(reloadPath, cacheControl("no-store", audit.wrap("reload", requireToken(tokens, reloadHandler(reload)))))
+		}
+	}
+	if *debugTokenFile != "" {
+		tokens, err := readTokenFile(*debugTokenFile, "debug")
+		if err != nil {
+			panic(err)
+		}
+		http.Handle(debugDomainPrefix, cacheControl("no-store", audit.wrap("debug", requireToken(tokens, domainDebugHandler(set)))))
+	}
+	http.Handle("/", gzipHandler(*gzipLevel, indexHandler(*metricsPath)))
+	// Metrics are served while waiting for libvirt, reporting libvirt_up
+	// as 0 until it can be reached.
+	if *libvirtStartupRetries > 0 {
+		for _, exporter := range exporters {
+			go func(uri string) {
+				if err := collector.WaitForLibvirt(uri, *libvirtStartupRetries, *libvirtStartupBackoff); err != nil {
+					log.Fatalf("Failed to connect to libvirt at %s after %d retries: %s", uri, *libvirtStartupRetries, err)
+				}
+			}(exporter.URI())
+		}
+	}
+	listener, err := listen(*listenAddress, *reusePort)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listener, err = webCfg.wrapListener(listener)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := serve(&http.Server{}, listener, *shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+	pool.Close()
+	if tracerProvider != nil {
+		// Spans not sent yet are flushed before exiting.
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			log.Printf("Failed to send the last traces: %s", err)
+		}
+	}
+}
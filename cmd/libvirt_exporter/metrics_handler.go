@@ -0,0 +1,75 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/priteau/libvirt_exporter/internal/collector"
+)
+
+// errorCommentHandler returns an HTTP handler serving the metrics of a
+// gatherer, followed by comments describing why the last collection of
+// each exporter failed, if it did. When there are several exporters, the
+// comments identify their URI. Comments are only supported by the text
+// exposition format, so they are omitted when another format is
+// negotiated. The OpenMetrics format, which exposes exemplars, can only
+// be negotiated if openMetrics is true, as with promhttp.HandlerOpts.
+func errorCommentHandler(gatherer prometheus.Gatherer, set *exporterSet, openMetrics bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exporters := set.Exporters()
+		// As with the default error handling of promhttp, metrics are
+		// not served if any of them failed to be gathered.
+		families, err := gatherer.Gather()
+		if err != nil {
+			http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		format := expfmt.Negotiate(r.Header)
+		if openMetrics {
+			format = expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		}
+		w.Header().Set("Content-Type", string(format))
+		encoder := expfmt.NewEncoder(w, format)
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				return
+			}
+		}
+		if closer, ok := encoder.(expfmt.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return
+			}
+		}
+		if format.FormatType() != expfmt.TypeTextPlain {
+			return
+		}
+		for _, e := range exporters {
+			collectErr := e.LastCollectError()
+			if collectErr == nil {
+				continue
+			}
+			uri := ""
+			if len(exporters) > 1 {
+				uri = e.URI()
+			}
+			fmt.Fprint(w, collector.FormatErrorComment(collectErr, uri))
+		}
+	})
+}
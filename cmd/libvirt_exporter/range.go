@@ -0,0 +1,162 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rangePath is the path of the endpoint returning the recent values of a
+// metric.
+const rangePath = "/api/v1/range"
+
+// rangeSeries is a series returned by a range query, in the format of the
+// Prometheus HTTP API: its labels, and its values as pairs of a time in
+// seconds since the Unix epoch and a formatted value.
+type rangeSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]interface{}  `json:"values"`
+}
+
+// rangeResponse is the response to a range query, in the format of the
+// Prometheus HTTP API, so that its clients can read it.
+type rangeResponse struct {
+	Status string     `json:"status"`
+	Data   *rangeData `json:"data,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+type rangeData struct {
+	ResultType string         `json:"resultType"`
+	Result     []*rangeSeries `json:"result"`
+}
+
+// seriesKey identifies a series by its labels.
+func seriesKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name)
+		key.WriteByte(0)
+		key.WriteString(labels[name])
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+// buildRange returns the values of the series of a metric family across
+// snapshots whose labels hold the given values, from the oldest snapshot,
+// and only from those taken since the given time.
+func buildRange(snapshots []*snapshot, name string, matchers map[string]string, since time.Time) []*rangeSeries {
+	result := []*rangeSeries{}
+	byKey := map[string]*rangeSeries{}
+	for _, snap := range snapshots {
+		if snap.time.Before(since) {
+			continue
+		}
+		timestamp := float64(snap.time.UnixNano()) / 1e9
+		forEachSeries(snap.families, name, func(labels map[string]string, value float64) {
+			for label, want := range matchers {
+				if labels[label] != want {
+					return
+				}
+			}
+			key := seriesKey(labels)
+			series := byKey[key]
+			if series == nil {
+				labels["__name__"] = name
+				series = &rangeSeries{Metric: labels}
+				byKey[key] = series
+				result = append(result, series)
+			}
+			series.Values = append(series.Values, [2]interface{}{timestamp, strconv.FormatFloat(value, 'f', -1, 64)})
+		})
+	}
+	return result
+}
+
+// writeRangeResponse writes the response to a range query as JSON.
+func writeRangeResponse(w http.ResponseWriter, code int, response *rangeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// rangeHandler returns an HTTP handler serving the values of a metric in
+// the snapshots kept by stats, such as
+// /api/v1/range?metric=libvirt_domain_info_memory_usage_bytes&domain=vm,
+// so that host-local tooling can graph the last scrapes without a
+// Prometheus server. The metric parameter is required, the optional
+// since parameter restricts values to those of the given duration, and
+// all other parameters select series by the values of their labels.
+func rangeHandler(stats *expositionStats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		name := query.Get("metric")
+		if name == "" {
+			writeRangeResponse(w, http.StatusBadRequest, &rangeResponse{Status: "error", Error: "the metric parameter is required"})
+			return
+		}
+		var since time.Time
+		if value := query.Get("since"); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				writeRangeResponse(w, http.StatusBadRequest, &rangeResponse{Status: "error", Error: "invalid since parameter: " + err.Error()})
+				return
+			}
+			since = time.Now().Add(-duration)
+		}
+		matchers := map[string]string{}
+		for label := range query {
+			if label != "metric" && label != "since" {
+				matchers[label] = query.Get(label)
+			}
+		}
+		writeRangeResponse(w, http.StatusOK, &rangeResponse{
+			Status: "success",
+			Data: &rangeData{
+				ResultType: "matrix",
+				Result:     buildRange(stats.allSnapshots(), name, matchers, since),
+			},
+		})
+	})
+}
+
+// recordHistory gathers metrics every interval, so that the history served
+// by range queries is recorded even without a Prometheus server scraping
+// the exporter. The gatherer must not count as a scrape, so that the
+// statistics of scrapes only reflect those of Prometheus.
+func recordHistory(stats *expositionStats, gatherer prometheus.Gatherer, interval time.Duration) {
+	for range time.Tick(interval) {
+		families, err := gatherer.Gather()
+		if err != nil {
+			log.Printf("Failed to gather metrics for the history: %s", err)
+		}
+		if len(families) > 0 {
+			stats.record(families)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/priteau/libvirt_exporter/internal/collector"
+)
+
+// reloadPath is the path of the endpoint used to reload the configuration
+// file.
+const reloadPath = "/-/reload"
+
+// exporterSet holds the exporters of all URIs, which are replaced when the
+// configuration is reloaded. Every generation of exporters is registered
+// in a registry of its own, so that a new generation can be registered
+// before the current one is discarded, even when the labels of their
+// metrics differ. The metrics of every exporter are labelled with its
+// URI, unless there is a single one. Their metrics can also be gathered
+// from a second registry without counting as scrapes.
+type exporterSet struct {
+	mu        sync.Mutex
+	exporters []*collector.LibvirtExporter
+	registry  *prometheus.Registry
+	unscraped *prometheus.Registry
+}
+
+func newExporterSet() *exporterSet {
+	return &exporterSet{registry: prometheus.NewRegistry(), unscraped: prometheus.NewRegistry()}
+}
+
+// Exporters returns the current exporters.
+func (s *exporterSet) Exporters() []*collector.LibvirtExporter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exporters
+}
+
+// Gather implements prometheus.Gatherer, gathering the metrics of the
+// current exporters.
+func (s *exporterSet) Gather() ([]*dto.MetricFamily, error) {
+	s.mu.Lock()
+	registry := s.registry
+	s.mu.Unlock()
+	return registry.Gather()
+}
+
+// unscrapedGatherer returns a gatherer of the metrics of the current
+// exporters that does not count as a scrape of the exporters.
+func (s *exporterSet) unscrapedGatherer() prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		s.mu.Lock()
+		registry := s.unscraped
+		s.mu.Unlock()
+		return registry.Gather()
+	})
+}
+
+// register registers the collectors of the provided exporters in a new
+// registry, labelling their metrics with the URI of their exporter if
+// there are several.
+func register(exporters []*collector.LibvirtExporter, collectorOf func(e *collector.LibvirtExporter) prometheus.Collector) (*prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	for _, e := range exporters {
+		var registerer prometheus.Registerer = registry
+		if len(exporters) > 1 {
+			registerer = prometheus.WrapRegistererWith(prometheus.Labels{"uri": e.URI()}, registerer)
+		}
+		if err := registerer.Register(collectorOf(e)); err != nil {
+			return nil, fmt.Errorf("failed to register exporter of %s: %s", e.URI(), err)
+		}
+	}
+	return registry, nil
+}
+
+// Replace registers the provided exporters in a new registry and, once
+// all of them are registered, starts them and stops the current ones.
+// If any of them fails to register, the current exporters are left in
+// place. The maintenance mode of hosts is carried over to the new
+// exporters of their URI.
+func (s *exporterSet) Replace(exporters []*collector.LibvirtExporter) error {
+	registry, err := register(exporters, func(e *collector.LibvirtExporter) prometheus.Collector {
+		return e
+	})
+	if err != nil {
+		return err
+	}
+	unscraped, err := register(exporters, (*collector.LibvirtExporter).Unscraped)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	previous := s.exporters
+	maintenance := map[string]bool{}
+	for _, e := range previous {
+		maintenance[e.URI()] = e.Maintenance()
+	}
+	for _, e := range exporters {
+		if enabled, ok := maintenance[e.URI()]; ok {
+			e.SetMaintenance(enabled)
+		}
+	}
+	s.exporters, s.registry, s.unscraped = exporters, registry, unscraped
+	s.mu.Unlock()
+
+	for _, e := range exporters {
+		e.StartCollectors()
+	}
+	for _, e := range previous {
+		e.StopCollectors()
+	}
+	return nil
+}
+
+// reloadHandler returns an HTTP handler reloading the configuration on
+// POST requests.
+func reloadHandler(reload func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, "Failed to reload configuration: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Configuration reloaded\n")
+	})
+}
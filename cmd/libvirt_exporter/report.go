@@ -0,0 +1,324 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// reportPath is the path of the endpoint serving a summary of the last
+// scrape.
+const reportPath = "/report"
+
+// reportTopDomains is the number of domains listed as top consumers of
+// every resource.
+const reportTopDomains = 5
+
+// report summarizes the metrics of a scrape for humans, host by host.
+type report struct {
+	Scraped time.Time
+	Hosts   []*hostReport
+}
+
+// hostReport summarizes the state of a libvirt host and of its domains.
+// Problems are failures that need attention, and warnings describe
+// configurations that are likely wrong.
+type hostReport struct {
+	URI         string
+	Up          bool
+	Maintenance bool
+	Domains     int
+	Running     int
+	TopCPU      []domainUsage
+	TopMemory   []domainUsage
+	Problems    []string
+	Warnings    []string
+}
+
+// domainUsage is the usage of a resource by a domain, formatted for
+// display.
+type domainUsage struct {
+	Domain string
+	Usage  string
+	value  float64
+}
+
+// forEachSeries calls fn with the labels and value of every series of the
+// metric family with the given name.
+func forEachSeries(families []*dto.MetricFamily, name string, fn func(labels map[string]string, value float64)) {
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.Metric {
+			labels := make(map[string]string, len(m.Label))
+			for _, pair := range m.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.Gauge.GetValue()
+			case m.Counter != nil:
+				value = m.Counter.GetValue()
+			case m.Untyped != nil:
+				value = m.Untyped.GetValue()
+			}
+			fn(labels, value)
+		}
+	}
+}
+
+// topUsage returns the reportTopDomains domains using the most of a
+// resource.
+func topUsage(usage []domainUsage) []domainUsage {
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].value > usage[j].value
+	})
+	if len(usage) > reportTopDomains {
+		usage = usage[:reportTopDomains]
+	}
+	return usage
+}
+
+// buildReport summarizes the last scrape. The CPU usage of domains is
+// computed from the previous scrape, if any. Metrics are labelled with
+// the URI of their host when there are several, otherwise uri is that of
+// the single host.
+func buildReport(last, previous *snapshot, uri string) *report {
+	hosts := map[string]*hostReport{}
+	host := func(labels map[string]string) *hostReport {
+		u, ok := labels["uri"]
+		if !ok {
+			u = uri
+		}
+		if hosts[u] == nil {
+			hosts[u] = &hostReport{URI: u}
+		}
+		return hosts[u]
+	}
+	families := last.families
+
+	forEachSeries(families, "libvirt_up", func(labels map[string]string, value float64) {
+		h := host(labels)
+		h.Up = value == 1
+		if !h.Up {
+			h.Problems = append(h.Problems, "libvirt cannot be reached")
+		}
+	})
+	forEachSeries(families, "libvirt_host_maintenance", func(labels map[string]string, value float64) {
+		host(labels).Maintenance = value == 1
+	})
+	forEachSeries(families, "libvirt_domain_state", func(labels map[string]string, value float64) {
+		if value != 1 {
+			return
+		}
+		h := host(labels)
+		h.Domains++
+		switch labels["state"] {
+		case "running":
+			h.Running++
+		case "crashed", "paused":
+			h.Problems = append(h.Problems, fmt.Sprintf("Domain %s is %s", labels["domain"], labels["state"]))
+		}
+	})
+	forEachSeries(families, "libvirt_domain_tpm_emulator_up", func(labels map[string]string, value float64) {
+		if value == 0 {
+			host(labels).Problems = append(host(labels).Problems, fmt.Sprintf("The TPM emulator of domain %s is down", labels["domain"]))
+		}
+	})
+	paths := map[[3]string]float64{}
+	forEachSeries(families, "libvirt_domain_block_multipath_paths", func(labels map[string]string, value float64) {
+		paths[[3]string{labels["uri"], labels["domain"], labels["target_device"]}] = value
+	})
+	forEachSeries(families, "libvirt_domain_block_multipath_active_paths", func(labels map[string]string, value float64) {
+		if total := paths[[3]string{labels["uri"], labels["domain"], labels["target_device"]}]; value < total {
+			host(labels).Problems = append(host(labels).Problems, fmt.Sprintf("Disk %s of domain %s has %g of %g multipath paths active", labels["target_device"], labels["domain"], value, total))
+		}
+	})
+
+	forEachSeries(families, "libvirt_host_graphics_port_conflicts", func(labels map[string]string, value float64) {
+		if value > 0 {
+			host(labels).Warnings = append(host(labels).Warnings, fmt.Sprintf("%g graphics ports are used by several domains", value))
+		}
+	})
+	forEachSeries(families, "libvirt_domain_blkio_weight_mismatch", func(labels map[string]string, value float64) {
+		if value == 1 {
+			host(labels).Warnings = append(host(labels).Warnings, fmt.Sprintf("The I/O weight of domain %s differs from that of its cgroup", labels["domain"]))
+		}
+	})
+	forEachSeries(families, "libvirt_domain_interface_mtu_mismatch", func(labels map[string]string, value float64) {
+		if value == 1 {
+			host(labels).Warnings = append(host(labels).Warnings, fmt.Sprintf("The MTUs of interface %s of domain %s, of its tap device and of its bridge differ", labels["target_device"], labels["domain"]))
+		}
+	})
+	forEachSeries(families, "libvirt_domain_xml_unknown_fields", func(labels map[string]string, value float64) {
+		host(labels).Warnings = append(host(labels).Warnings, fmt.Sprintf("The XML description of domain %s has a field unknown to the exporter: %s", labels["domain"], labels["field"]))
+	})
+
+	memory := map[string][]domainUsage{}
+	forEachSeries(families, "libvirt_domain_info_memory_usage_bytes", func(labels map[string]string, value float64) {
+		h := host(labels)
+		memory[h.URI] = append(memory[h.URI], domainUsage{Domain: labels["domain"], Usage: fmt.Sprintf("%.1f GiB", value/(1<<30)), value: value})
+	})
+	cpu := map[string][]domainUsage{}
+	if previous != nil {
+		elapsed := last.time.Sub(previous.time).Seconds()
+		cpuTimes := map[[2]string]float64{}
+		forEachSeries(previous.families, "libvirt_domain_info_cpu_time_seconds_total", func(labels map[string]string, value float64) {
+			cpuTimes[[2]string{labels["uri"], labels["domain"]}] = value
+		})
+		forEachSeries(families, "libvirt_domain_info_cpu_time_seconds_total", func(labels map[string]string, value float64) {
+			before, ok := cpuTimes[[2]string{labels["uri"], labels["domain"]}]
+			if !ok || value < before || elapsed <= 0 {
+				return
+			}
+			h := host(labels)
+			used := (value - before) / elapsed
+			cpu[h.URI] = append(cpu[h.URI], domainUsage{Domain: labels["domain"], Usage: fmt.Sprintf("%.2f CPUs", used), value: used})
+		})
+	}
+
+	r := &report{Scraped: last.time}
+	for _, h := range hosts {
+		h.TopCPU = topUsage(cpu[h.URI])
+		h.TopMemory = topUsage(memory[h.URI])
+		sort.Strings(h.Problems)
+		sort.Strings(h.Warnings)
+		r.Hosts = append(r.Hosts, h)
+	}
+	sort.Slice(r.Hosts, func(i, j int) bool {
+		return r.Hosts[i].URI < r.Hosts[j].URI
+	})
+	return r
+}
+
+// reportFuncs are the functions shared by the templates of reports.
+var reportFuncs = map[string]interface{}{
+	"time": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"yesno": func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	},
+}
+
+var markdownReportTemplate = template.Must(template.New("report").Funcs(reportFuncs).Parse(
+	`# Libvirt exporter report
+
+Built from the scrape of {{time .Scraped}}.
+{{range .Hosts}}
+## {{.URI}}
+
+- libvirt reachable: {{yesno .Up}}
+- Maintenance: {{yesno .Maintenance}}
+- Domains: {{.Domains}}, of which {{.Running}} running
+{{if .TopCPU}}
+### Top CPU consumers
+
+{{range .TopCPU}}- {{.Domain}}: {{.Usage}}
+{{end}}{{end}}{{if .TopMemory}}
+### Top memory consumers
+
+{{range .TopMemory}}- {{.Domain}}: {{.Usage}}
+{{end}}{{end}}{{if .Problems}}
+### Problems
+
+{{range .Problems}}- {{.}}
+{{end}}{{end}}{{if .Warnings}}
+### Configuration warnings
+
+{{range .Warnings}}- {{.}}
+{{end}}{{end}}{{end}}`))
+
+var htmlReportTemplate = htmltemplate.Must(htmltemplate.New("report").Funcs(reportFuncs).Parse(
+	`<html>
+<head><title>Libvirt Exporter Report</title></head>
+<body>
+<h1>Libvirt exporter report</h1>
+<p>Built from the scrape of {{time .Scraped}}.</p>
+{{range .Hosts}}
+<h2>{{.URI}}</h2>
+<ul>
+<li>libvirt reachable: {{yesno .Up}}</li>
+<li>Maintenance: {{yesno .Maintenance}}</li>
+<li>Domains: {{.Domains}}, of which {{.Running}} running</li>
+</ul>
+{{if .TopCPU}}<h3>Top CPU consumers</h3>
+<ul>{{range .TopCPU}}<li>{{.Domain}}: {{.Usage}}</li>{{end}}</ul>
+{{end}}{{if .TopMemory}}<h3>Top memory consumers</h3>
+<ul>{{range .TopMemory}}<li>{{.Domain}}: {{.Usage}}</li>{{end}}</ul>
+{{end}}{{if .Problems}}<h3>Problems</h3>
+<ul>{{range .Problems}}<li>{{.}}</li>{{end}}</ul>
+{{end}}{{if .Warnings}}<h3>Configuration warnings</h3>
+<ul>{{range .Warnings}}<li>{{.}}</li>{{end}}</ul>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// wantsHTML returns whether a report is requested in HTML rather than in
+// Markdown, either explicitly or by a browser.
+func wantsHTML(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "html":
+		return true
+	case "markdown":
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// reportHandler returns an HTTP handler serving a report built from the
+// last scrape of the metrics endpoint, in Markdown or in HTML, so that it
+// can be pasted where dashboards cannot be accessed. Metrics are not
+// collected for reports, which are therefore unavailable until metrics
+// have been scraped.
+func reportHandler(stats *expositionStats, set *exporterSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last, previous := stats.snapshots()
+		if last == nil {
+			http.Error(w, "No metrics were scraped yet", http.StatusServiceUnavailable)
+			return
+		}
+		var uri string
+		if exporters := set.Exporters(); len(exporters) == 1 {
+			uri = exporters[0].URI()
+		}
+		rep := buildReport(last, previous, uri)
+		var err error
+		if wantsHTML(r) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = htmlReportTemplate.Execute(w, rep)
+		} else {
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			err = markdownReportTemplate.Execute(w, rep)
+		}
+		if err != nil {
+			io.WriteString(w, "\nFailed to render report: "+err.Error()+"\n")
+		}
+	})
+}
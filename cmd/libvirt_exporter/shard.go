@@ -0,0 +1,75 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// parseURIs returns the libvirt URIs given with --libvirt.uri, which can
+// be repeated or hold comma-separated lists of URIs. Duplicates are
+// removed.
+func parseURIs(values []string) []string {
+	var uris []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, uri := range strings.Split(value, ",") {
+			uri = strings.TrimSpace(uri)
+			if uri != "" && !seen[uri] {
+				uris = append(uris, uri)
+				seen[uri] = true
+			}
+		}
+	}
+	return uris
+}
+
+// shardURIs returns the URIs assigned to a shard, when distributing URIs
+// across total shards. URIs are assigned through rendezvous hashing, so
+// that every replica of the exporter computes the same assignment
+// independently, and adding or removing a URI only moves that URI.
+func shardURIs(uris []string, index, total int) ([]string, error) {
+	if total < 1 {
+		return nil, fmt.Errorf("invalid total number of shards %d, must be at least 1", total)
+	}
+	if index < 0 || index >= total {
+		return nil, fmt.Errorf("invalid shard index %d, must be between 0 and %d", index, total-1)
+	}
+
+	var assigned []string
+	for _, uri := range uris {
+		if uriShard(uri, total) == index {
+			assigned = append(assigned, uri)
+		}
+	}
+	return assigned, nil
+}
+
+// uriShard returns the shard with the highest hash for a URI.
+func uriShard(uri string, total int) int {
+	best, bestHash := 0, uint64(0)
+	for shard := 0; shard < total; shard++ {
+		h := fnv.New64a()
+		h.Write([]byte(strconv.Itoa(shard)))
+		h.Write([]byte{0})
+		h.Write([]byte(uri))
+		if sum := h.Sum64(); shard == 0 || sum > bestHash {
+			best, bestHash = shard, sum
+		}
+	}
+	return best
+}
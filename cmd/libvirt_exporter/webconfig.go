@@ -0,0 +1,205 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// webConfig holds the web configuration read from --web.config.file. It
+// follows the format of the Prometheus exporter toolkit, so that the same
+// files can be shared with other exporters.
+type webConfig struct {
+	TLSServerConfig *tlsServerConfig  `yaml:"tls_server_config"`
+	BasicAuthUsers  map[string]string `yaml:"basic_auth_users"`
+
+	// authenticated holds digests of the credentials that matched the
+	// bcrypt hash of their user. bcrypt is deliberately slow, so it is
+	// only run on the first request of every user rather than on every
+	// scrape. Only matching credentials are remembered, so that requests
+	// with wrong passwords cannot grow the cache.
+	mu            sync.Mutex
+	authenticated map[[sha256.Size]byte]bool
+}
+
+// tlsServerConfig holds the settings of the TLS server.
+type tlsServerConfig struct {
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+	MinVersion     string `yaml:"min_version"`
+	MaxVersion     string `yaml:"max_version"`
+}
+
+// clientAuthTypes maps the values of client_auth_type to the policies of
+// crypto/tls.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// tlsVersions maps the values of min_version and max_version to the
+// versions of crypto/tls.
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// readWebConfig reads and validates a web configuration file.
+func readWebConfig(path string) (*webConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c webConfig
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	if c.TLSServerConfig != nil {
+		// Check the settings once, so that mistakes are reported at
+		// startup rather than on the first connection.
+		if _, err := c.TLSServerConfig.tlsConfig(); err != nil {
+			return nil, fmt.Errorf("invalid TLS configuration in %s: %s", path, err)
+		}
+	}
+	return &c, nil
+}
+
+// tlsConfig returns the configuration of the TLS server. The certificate
+// is read again on every handshake, so that it can be renewed without
+// restarting the exporter.
+func (c *tlsServerConfig) tlsConfig() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("both cert_file and key_file must be set")
+	}
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			return &cert, err
+		},
+	}
+
+	clientAuth, ok := clientAuthTypes[c.ClientAuthType]
+	if !ok {
+		return nil, fmt.Errorf("unknown client_auth_type %q", c.ClientAuthType)
+	}
+	config.ClientAuth = clientAuth
+	if c.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", c.ClientCAFile)
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client_ca_file must be set to verify client certificates")
+	}
+
+	for _, version := range []struct {
+		name  string
+		value *uint16
+	}{
+		{c.MinVersion, &config.MinVersion},
+		{c.MaxVersion, &config.MaxVersion},
+	} {
+		if version.name == "" {
+			continue
+		}
+		v, ok := tlsVersions[version.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", version.name)
+		}
+		*version.value = v
+	}
+	return config, nil
+}
+
+// wrapListener returns a listener serving TLS if it is configured, or the
+// provided listener otherwise.
+func (c *webConfig) wrapListener(listener net.Listener) (net.Listener, error) {
+	if c.TLSServerConfig == nil {
+		return listener, nil
+	}
+	config, err := c.TLSServerConfig.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(listener, config), nil
+}
+
+// checkPassword returns whether the password is the one of the user,
+// whose bcrypt hash is configured.
+func (c *webConfig) checkPassword(user, password string) bool {
+	hash, found := c.BasicAuthUsers[user]
+	if !found {
+		return false
+	}
+	key := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + password))
+	c.mu.Lock()
+	cached := c.authenticated[key]
+	c.mu.Unlock()
+	if cached {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	c.mu.Lock()
+	if c.authenticated == nil {
+		c.authenticated = make(map[[sha256.Size]byte]bool)
+	}
+	c.authenticated[key] = true
+	c.mu.Unlock()
+	return true
+}
+
+// requireBasicAuth wraps an HTTP handler, only letting through requests
+// that carry the password of one of the configured users, if any. The
+// passwords are stored as bcrypt hashes.
+func (c *webConfig) requireBasicAuth(handler http.Handler) http.Handler {
+	if len(c.BasicAuthUsers) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); ok && c.checkPassword(user, password) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", "Basic")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
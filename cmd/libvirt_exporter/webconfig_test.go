@@ -0,0 +1,164 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeTestFile writes a file in a temporary directory and returns its
+// path.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %s", name, err)
+	}
+	return path
+}
+
+// writeTestCert writes a self-signed certificate and its key, and returns
+// their paths.
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %s", err)
+	}
+	certFile := writeTestFile(t, "cert.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	keyFile := writeTestFile(t, "key.pem", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+	return certFile, keyFile
+}
+
+func TestReadWebConfig(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	tests := []struct {
+		name   string
+		config string
+		valid  bool
+	}{
+		{"empty", "", true},
+		{"basic auth", "basic_auth_users:\n  alice: $2y$10$abc\n", true},
+		{"tls", "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  min_version: TLS13\n", true},
+		{"unknown field", "basic_auth_user:\n  alice: $2y$10$abc\n", false},
+		{"missing key", "tls_server_config:\n  cert_file: " + certFile + "\n", false},
+		{"missing certificate", "tls_server_config:\n  cert_file: /nonexistent\n  key_file: " + keyFile + "\n", false},
+		{"unknown client auth", "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_auth_type: Always\n", false},
+		{"verify without CA", "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_auth_type: RequireAndVerifyClientCert\n", false},
+		{"verify with CA", "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_auth_type: RequireAndVerifyClientCert\n  client_ca_file: " + certFile + "\n", true},
+		{"unknown version", "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  max_version: SSL3\n", false},
+	}
+	for _, test := range tests {
+		_, err := readWebConfig(writeTestFile(t, "web.yml", test.config))
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestWrapListener(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	c, err := readWebConfig(writeTestFile(t, "web.yml", "tls_server_config:\n  cert_file: "+certFile+"\n  key_file: "+keyFile+"\n"))
+	if err != nil {
+		t.Fatalf("Failed to read web configuration: %s", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	listener, err := c.wrapListener(server.Listener)
+	if err != nil {
+		t.Fatalf("Failed to wrap listener: %s", err)
+	}
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect with TLS: %s", err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil {
+		t.Errorf("Response was not served with TLS")
+	}
+}
+
+func TestRequireBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %s", err)
+	}
+	c := &webConfig{BasicAuthUsers: map[string]string{"alice": string(hash)}}
+	handler := c.requireBasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		auth     bool
+		want     int
+	}{
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"valid", "alice", "secret", true, http.StatusOK},
+		{"valid again", "alice", "secret", true, http.StatusOK},
+		{"wrong password", "alice", "guess", true, http.StatusUnauthorized},
+		{"unknown user", "bob", "secret", true, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if test.auth {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+	if len(c.authenticated) != 1 {
+		t.Errorf("Got %d cached credentials, want 1", len(c.authenticated))
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+// SetMaintenance enables or disables the maintenance mode of the host.
+func (e *LibvirtExporter) SetMaintenance(enabled bool) {
+	e.maintenanceMu.Lock()
+	defer e.maintenanceMu.Unlock()
+	e.maintenance = enabled
+}
+
+// Maintenance returns whether the host is in maintenance mode.
+func (e *LibvirtExporter) Maintenance() bool {
+	e.maintenanceMu.Lock()
+	defer e.maintenanceMu.Unlock()
+	return e.maintenance
+}
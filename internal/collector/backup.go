@@ -0,0 +1,111 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// parseBackupTime parses the time of a backup, given either as seconds
+// since the Unix epoch or in RFC 3339 format.
+func parseBackupTime(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(seconds) && !math.IsInf(seconds, 0) {
+		return seconds, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return float64(t.UnixNano()) / 1e9, nil
+}
+
+// latestCheckpointTime returns the creation time of the latest checkpoint
+// of a domain, or 0 if it has none. Only the leaves of the tree of
+// checkpoints are looked up, as their parents are older.
+func (e *LibvirtExporter) latestCheckpointTime(domain *libvirt.Domain, domainName string) int64 {
+	checkpoints, err := domain.ListAllCheckpoints(libvirt.DOMAIN_CHECKPOINT_LIST_LEAVES)
+	if err != nil {
+		e.countError("virDomainListAllCheckpoints", err)
+		if !isNoSupport(err) {
+			e.logger.Printf("Failed to list checkpoints of domain %s: %s", domainName, err)
+		}
+		return 0
+	}
+	var latest int64
+	for _, checkpoint := range checkpoints {
+		xmlDesc, err := checkpoint.GetXMLDesc(0)
+		checkpoint.Free()
+		if err != nil {
+			e.countError("virDomainCheckpointGetXMLDesc", err)
+			continue
+		}
+		var desc libvirt_schema.DomainCheckpoint
+		if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+			e.logger.Printf("Failed to parse checkpoint of domain %s: %s", domainName, err)
+			continue
+		}
+		if desc.CreationTime > latest {
+			latest = desc.CreationTime
+		}
+	}
+	return latest
+}
+
+// CollectDomainLastBackup reports the time of the last successful backup
+// of a domain, so that backups can be alerted on per domain. It is read
+// from the element of its metadata in the namespace set with
+// --libvirt.backup-metadata-namespace, which backup tools can set with
+// 'virsh metadata' once a backup succeeds. Otherwise, if enabled, the
+// creation time of its latest checkpoint is used, which is when the last
+// incremental backup started. domain is nil when previewing a domain.
+func (e *LibvirtExporter) CollectDomainLastBackup(ch chan<- prometheus.Metric, domain *libvirt.Domain, domainName string, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	if e.backupNamespace != "" {
+		for _, element := range desc.Metadata.Elements {
+			if element.XMLName.Space != e.backupNamespace {
+				continue
+			}
+			seconds, err := parseBackupTime(element.Text)
+			if err != nil {
+				e.logger.Printf("Invalid backup time in metadata of domain %s: %s", domainName, err)
+				break
+			}
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainLastBackupDesc,
+				prometheus.GaugeValue,
+				seconds,
+				domainLabelValues...)
+			return
+		}
+	}
+	if !e.exportCheckpoints || domain == nil {
+		return
+	}
+	if latest := e.latestCheckpointTime(domain, domainName); latest > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainLastBackupDesc,
+			prometheus.GaugeValue,
+			float64(latest),
+			domainLabelValues...)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// writeTestNode writes the description of a node of the libvirt test
+// driver running the given number of domains, each with a disk and an
+// interface, and returns its URI. The fixture is generated rather than
+// stored, so that it is identical on every run.
+func writeTestNode(tb testing.TB, domains int) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "node.xml")
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatalf("Failed to create test node: %s", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "<node>")
+	for i := 0; i < domains; i++ {
+		fmt.Fprintf(w, `<domain type='test'>
+  <name>domain-%d</name>
+  <uuid>%08x-0000-4000-8000-000000000000</uuid>
+  <memory>1048576</memory>
+  <vcpu>2</vcpu>
+  <os><type>hvm</type></os>
+  <devices>
+    <disk type='file' device='disk'><source file='/guest/domain-%d.img'/><target dev='hda'/></disk>
+    <interface type='bridge'><source bridge='br0'/><target dev='vnet%d'/></interface>
+  </devices>
+</domain>
+`, i, i, i, i)
+	}
+	fmt.Fprintln(w, "</node>")
+	if err := w.Flush(); err != nil {
+		tb.Fatalf("Failed to write test node: %s", err)
+	}
+	return "test://" + path
+}
+
+// benchmarkScrape measures the latency and allocations of a scrape of a
+// node running the given number of domains.
+func benchmarkScrape(b *testing.B, domains int) {
+	e := newTestExporter(b, writeTestNode(b, domains))
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(e); err != nil {
+		b.Fatalf("Failed to register exporter: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	series := 0
+	for i := 0; i < b.N; i++ {
+		families, err := registry.Gather()
+		if err != nil {
+			b.Fatalf("Failed to gather metrics: %s", err)
+		}
+		series = 0
+		for _, family := range families {
+			series += len(family.GetMetric())
+		}
+	}
+	b.ReportMetric(float64(series), "series/op")
+}
+
+func BenchmarkScrape500Domains(b *testing.B) {
+	benchmarkScrape(b, 500)
+}
+
+func BenchmarkScrape2000Domains(b *testing.B) {
+	benchmarkScrape(b, 2000)
+}
+
+// benchmarkRetainedHeap measures the heap held once the metrics of the
+// last two scrapes of a node running 2000 domains are retained, as they
+// are by the summary of the last scrape, with or without interning label
+// values.
+func benchmarkRetainedHeap(b *testing.B, intern bool) {
+	e := newTestExporter(b, writeTestNode(b, 2000))
+	if !intern {
+		e.labelValues = nil
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(e); err != nil {
+		b.Fatalf("Failed to register exporter: %s", err)
+	}
+
+	var retained [2][]*dto.MetricFamily
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		families, err := registry.Gather()
+		if err != nil {
+			b.Fatalf("Failed to gather metrics: %s", err)
+		}
+		retained[i%2] = families
+	}
+	b.StopTimer()
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	runtime.KeepAlive(retained)
+	b.ReportMetric(float64(stats.HeapAlloc), "heap-bytes")
+}
+
+func BenchmarkRetainedHeap(b *testing.B) {
+	b.Run("interned", func(b *testing.B) {
+		benchmarkRetainedHeap(b, true)
+	})
+	b.Run("plain", func(b *testing.B) {
+		benchmarkRetainedHeap(b, false)
+	})
+}
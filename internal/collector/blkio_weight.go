@@ -0,0 +1,61 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainBlkioWeight reports the I/O weight configured for a domain
+// and, for running QEMU domains of local hosts, compares it with the
+// weight actually set in the cgroup of the domain. They differ when a live
+// change made with 'virsh blkiotune' did not reach the cgroup, or was
+// lost, for instance when the cgroup was recreated while libvirtd was
+// restarting.
+func (e *LibvirtExporter) CollectDomainBlkioWeight(ch chan<- prometheus.Metric, domainName string, domainLabelValues []string, desc *libvirt_schema.Domain, running bool) {
+	configured := desc.BlkioTune.Weight
+	if configured == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtDomainBlkioWeightDesc,
+		prometheus.GaugeValue,
+		float64(configured),
+		domainLabelValues...)
+
+	if !e.local || !running || (desc.Type != "kvm" && desc.Type != "qemu") {
+		return
+	}
+	observed, err := domainCgroupBlkioWeight(domainName)
+	if err != nil {
+		e.logger.Printf("Failed to read I/O weight of domain %s from its cgroup: %s", domainName, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtDomainBlkioCgroupWeightDesc,
+		prometheus.GaugeValue,
+		float64(observed),
+		domainLabelValues...)
+	mismatch := 0.0
+	if observed != uint64(configured) {
+		mismatch = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtDomainBlkioWeightMismatchDesc,
+		prometheus.GaugeValue,
+		mismatch,
+		domainLabelValues...)
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainBlockIoTune reports the I/O limits set on the disks of a
+// running domain, e.g. with 'virsh blkdeviotune', so that they can be
+// compared with the actual throughput of the disks. Limits that are not
+// set, reported by libvirt as 0, are skipped.
+func (e *LibvirtExporter) CollectDomainBlockIoTune(ch chan<- prometheus.Metric, domain *libvirt.Domain, domainName string, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for _, disk := range desc.Devices.Disks {
+		if disk.Device == "cdrom" || disk.Device == "fd" || disk.Target.Device == "" {
+			continue
+		}
+		params, err := domain.GetBlockIoTune(disk.Target.Device, libvirt.DOMAIN_AFFECT_LIVE)
+		if err != nil {
+			e.countError("virDomainGetBlockIoTune", err)
+			if isNoSupport(err) {
+				return
+			}
+			e.logger.Printf("Failed to get I/O limits of disk %s of domain %s: %s", disk.Target.Device, domainName, err)
+			continue
+		}
+
+		blockLabelValues := append(domainLabelValues, e.blockSourceLabelValue(&disk), disk.Target.Device)
+		for _, limit := range []struct {
+			desc      *prometheus.Desc
+			direction string
+			set       bool
+			value     uint64
+		}{
+			{e.libvirtDomainBlockIoTuneBytesDesc, "total", params.TotalBytesSecSet, params.TotalBytesSec},
+			{e.libvirtDomainBlockIoTuneBytesDesc, "read", params.ReadBytesSecSet, params.ReadBytesSec},
+			{e.libvirtDomainBlockIoTuneBytesDesc, "write", params.WriteBytesSecSet, params.WriteBytesSec},
+			{e.libvirtDomainBlockIoTuneIopsDesc, "total", params.TotalIopsSecSet, params.TotalIopsSec},
+			{e.libvirtDomainBlockIoTuneIopsDesc, "read", params.ReadIopsSecSet, params.ReadIopsSec},
+			{e.libvirtDomainBlockIoTuneIopsDesc, "write", params.WriteIopsSecSet, params.WriteIopsSec},
+			{e.libvirtDomainBlockIoTuneBurstBytesDesc, "total", params.TotalBytesSecMaxSet, params.TotalBytesSecMax},
+			{e.libvirtDomainBlockIoTuneBurstBytesDesc, "read", params.ReadBytesSecMaxSet, params.ReadBytesSecMax},
+			{e.libvirtDomainBlockIoTuneBurstBytesDesc, "write", params.WriteBytesSecMaxSet, params.WriteBytesSecMax},
+			{e.libvirtDomainBlockIoTuneBurstIopsDesc, "total", params.TotalIopsSecMaxSet, params.TotalIopsSecMax},
+			{e.libvirtDomainBlockIoTuneBurstIopsDesc, "read", params.ReadIopsSecMaxSet, params.ReadIopsSecMax},
+			{e.libvirtDomainBlockIoTuneBurstIopsDesc, "write", params.WriteIopsSecMaxSet, params.WriteIopsSecMax},
+		} {
+			if !limit.set || limit.value == 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				limit.desc,
+				prometheus.GaugeValue,
+				float64(limit.value),
+				append(blockLabelValues, limit.direction)...)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops connecting to a host after a number of consecutive
+// failures, for a cooldown period, so that scrapes do not wait for the
+// connection timeout of a dead hypervisor every time. Once the cooldown
+// expires, connecting is attempted again, and a single failure opens the
+// circuit for another cooldown. A nil circuitBreaker always allows
+// connecting.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// newCircuitBreaker returns a circuit breaker opening after threshold
+// consecutive failures, or nil if threshold is not positive.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow returns an error if the circuit is open.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Now().Before(b.openUntil) {
+		return fmt.Errorf("not connecting after %d consecutive failures until %s", b.failures, b.openUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// record records the outcome of an attempt to connect, opening the
+// circuit once the threshold of consecutive failures is reached.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures, b.openUntil = 0, time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// isOpen returns whether connecting is currently skipped.
+func (b *circuitBreaker) isOpen() bool {
+	return b.allow() != nil
+}
+
+// HostLimiter limits the number of hosts whose metrics are collected
+// concurrently, so that scraping many hosts at once does not exhaust the
+// resources of the exporter. A nil HostLimiter sets no limit.
+type HostLimiter struct {
+	slots chan struct{}
+}
+
+// NewHostLimiter returns a limiter allowing maxHosts hosts to be
+// collected concurrently, or nil if maxHosts is not positive.
+func NewHostLimiter(maxHosts int) *HostLimiter {
+	if maxHosts <= 0 {
+		return nil
+	}
+	return &HostLimiter{slots: make(chan struct{}, maxHosts)}
+}
+
+// acquire waits until a host can be collected.
+func (l *HostLimiter) acquire() {
+	if l != nil {
+		l.slots <- struct{}{}
+	}
+}
+
+// release allows another host to be collected.
+func (l *HostLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	b := newCircuitBreaker(2, time.Hour)
+	failure := errors.New("connection refused")
+	b.record(failure)
+	if err := b.allow(); err != nil {
+		t.Errorf("Circuit opened before the threshold: %s", err)
+	}
+	b.record(failure)
+	if b.allow() == nil {
+		t.Error("Circuit did not open at the threshold")
+	}
+
+	// Once the cooldown expires, a single failure opens the circuit
+	// again, and a success closes it.
+	b.openUntil = time.Now()
+	if err := b.allow(); err != nil {
+		t.Errorf("Circuit stayed open after the cooldown: %s", err)
+	}
+	b.record(failure)
+	if !b.isOpen() {
+		t.Error("Circuit did not open again after a failure following the cooldown")
+	}
+	b.openUntil = time.Now()
+	b.record(nil)
+	b.record(failure)
+	if b.isOpen() {
+		t.Error("Circuit opened after a single failure following a success")
+	}
+
+	if newCircuitBreaker(0, time.Hour).isOpen() {
+		t.Error("Disabled circuit breaker is open")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// qemuStateDir is the directory in which the system instance of the QEMU
+// driver of libvirt stores the PID files of running domains.
+const qemuStateDir = "/run/libvirt/qemu"
+
+// cgroupStats holds the statistics of a domain read from its cgroup.
+type cgroupStats struct {
+	cpuTimeSet bool
+	// cpuTime is in nanoseconds.
+	cpuTime uint64
+
+	ioSet      bool
+	readBytes  uint64
+	writeBytes uint64
+	readReqs   uint64
+	writeReqs  uint64
+}
+
+// domainPID returns the PID of the QEMU process of a running domain, read
+// from its PID file.
+func domainPID(domainName string) (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(qemuStateDir, domainName+".pid"))
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID file of domain %s: %s", domainName, err)
+	}
+	return pid, nil
+}
+
+// domainCgroupStats reads the statistics of a running domain from the
+// cgroup of its QEMU process, found through its PID file.
+func domainCgroupStats(domainName string) (*cgroupStats, error) {
+	pid, err := domainPID(domainName)
+	if err != nil {
+		return nil, err
+	}
+	return readCgroupStats(pid)
+}
+
+// domainCgroupBlkioWeight reads the I/O weight of a running domain from
+// the cgroup of its QEMU process.
+func domainCgroupBlkioWeight(domainName string) (uint64, error) {
+	pid, err := domainPID(domainName)
+	if err != nil {
+		return 0, err
+	}
+	return readCgroupBlkioWeight(pid)
+}
+
+// collectCgroupFallback fills the gaps of the statistics of a running
+// domain that libvirt failed to report, typically because the QEMU
+// monitor was busy, with those read from its cgroup. The CPU time of the
+// domain is replaced in stats, as libvirt reads it from the same cgroup.
+// Block statistics cannot be attributed to disks, so the I/O of the whole
+// domain is reported instead.
+func (e *LibvirtExporter) collectCgroupFallback(ch chan<- prometheus.Metric, domainName string, domainLabelValues []string, stats *libvirt.DomainStats, hasDisks bool) {
+	cpuMissing := stats.Cpu == nil || !stats.Cpu.TimeSet
+	blockMissing := !e.disabled["blockstats"] && hasDisks && len(stats.Block) == 0
+	if !cpuMissing && !blockMissing {
+		return
+	}
+	cgroup, err := domainCgroupStats(domainName)
+	if err != nil {
+		e.logger.Printf("Failed to read statistics of domain %s from its cgroup: %s", domainName, err)
+		return
+	}
+
+	if cpuMissing && cgroup.cpuTimeSet {
+		e.libvirtDomainCgroupFallbacks.WithLabelValues("cpu").Inc()
+		stats.Cpu = &libvirt.DomainStatsCPU{TimeSet: true, Time: cgroup.cpuTime}
+	}
+	if blockMissing && cgroup.ioSet {
+		e.libvirtDomainCgroupFallbacks.WithLabelValues("block").Inc()
+		for _, m := range []struct {
+			desc  *prometheus.Desc
+			value uint64
+		}{
+			{e.libvirtDomainCgroupIOReadBytesDesc, cgroup.readBytes},
+			{e.libvirtDomainCgroupIOWriteBytesDesc, cgroup.writeBytes},
+			{e.libvirtDomainCgroupIOReadReqsDesc, cgroup.readReqs},
+			{e.libvirtDomainCgroupIOWriteReqsDesc, cgroup.writeReqs},
+		} {
+			ch <- prometheus.MustNewConstMetric(m.desc, prometheus.CounterValue, float64(m.value), domainLabelValues...)
+		}
+	}
+}
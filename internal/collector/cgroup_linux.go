@@ -0,0 +1,215 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is the mount point of the cgroup filesystems.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// processCgroups returns the cgroups of a process by controller, as listed
+// in /proc/<pid>/cgroup. The cgroup of the unified hierarchy of cgroup v2
+// has an empty controller.
+func processCgroups(pid int) (map[string]string, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+	cgroups := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[1] == "" {
+			cgroups[""] = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			cgroups[controller] = fields[2]
+		}
+	}
+	return cgroups, nil
+}
+
+// domainCgroup returns the cgroup of a domain from that of its QEMU
+// process. The process is placed in a child cgroup of that of the domain,
+// whose other children hold the virtual CPU threads.
+func domainCgroup(path string) string {
+	for p := path; p != "/" && p != "."; p = filepath.Dir(p) {
+		// The cgroup of domains registered with systemd-machined.
+		if strings.HasSuffix(p, ".scope") {
+			return p
+		}
+	}
+	if filepath.Base(path) == "emulator" {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// readKeyedValues reads a file of whitespace-separated keys and values,
+// such as cpu.stat, calling fn for every line of at least two fields.
+func readKeyedValues(path string, fn func(fields []string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 {
+			fn(fields)
+		}
+	}
+	return scanner.Err()
+}
+
+// readCgroupStats reads the CPU time and I/O of the domain whose QEMU
+// process has the given PID, from either cgroup v1 or cgroup v2.
+func readCgroupStats(pid int) (*cgroupStats, error) {
+	cgroups, err := processCgroups(pid)
+	if err != nil {
+		return nil, err
+	}
+	stats := &cgroupStats{}
+	if path, ok := cgroups["cpuacct"]; ok {
+		data, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cpuacct", domainCgroup(path), "cpuacct.usage"))
+		if err == nil {
+			stats.cpuTime, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+			stats.cpuTimeSet = err == nil
+		}
+	} else if path, ok := cgroups[""]; ok {
+		readKeyedValues(filepath.Join(cgroupRoot, domainCgroup(path), "cpu.stat"), func(fields []string) {
+			if fields[0] == "usage_usec" {
+				if usec, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+					stats.cpuTime, stats.cpuTimeSet = usec*1000, true
+				}
+			}
+		})
+	}
+
+	if path, ok := cgroups["blkio"]; ok {
+		// Lines are of the form "<major>:<minor> <operation> <value>",
+		// summed over all devices.
+		dir := filepath.Join(cgroupRoot, "blkio", domainCgroup(path))
+		stats.ioSet = true
+		for _, file := range []struct {
+			name        string
+			read, write *uint64
+		}{
+			{"blkio.throttle.io_service_bytes", &stats.readBytes, &stats.writeBytes},
+			{"blkio.throttle.io_serviced", &stats.readReqs, &stats.writeReqs},
+		} {
+			err := readKeyedValues(filepath.Join(dir, file.name), func(fields []string) {
+				if len(fields) != 3 {
+					return
+				}
+				value, err := strconv.ParseUint(fields[2], 10, 64)
+				if err != nil {
+					return
+				}
+				switch fields[1] {
+				case "Read":
+					*file.read += value
+				case "Write":
+					*file.write += value
+				}
+			})
+			if err != nil {
+				stats.ioSet = false
+			}
+		}
+	} else if path, ok := cgroups[""]; ok {
+		// Lines are of the form "<major>:<minor> rbytes=<value> ...",
+		// summed over all devices.
+		err := readKeyedValues(filepath.Join(cgroupRoot, domainCgroup(path), "io.stat"), func(fields []string) {
+			for _, field := range fields[1:] {
+				parts := strings.SplitN(field, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				value, err := strconv.ParseUint(parts[1], 10, 64)
+				if err != nil {
+					continue
+				}
+				switch parts[0] {
+				case "rbytes":
+					stats.readBytes += value
+				case "wbytes":
+					stats.writeBytes += value
+				case "rios":
+					stats.readReqs += value
+				case "wios":
+					stats.writeReqs += value
+				}
+			}
+		})
+		stats.ioSet = err == nil
+	}
+
+	if !stats.cpuTimeSet && !stats.ioSet {
+		return nil, fmt.Errorf("no statistics found in cgroups of process %d", pid)
+	}
+	return stats, nil
+}
+
+// readCgroupBlkioWeight reads the I/O weight of the domain whose QEMU
+// process has the given PID. Like libvirt, the weight of the BFQ scheduler
+// is preferred when it is available. Files hold either the weight alone
+// or a "default <weight>" line followed by per-device weights.
+func readCgroupBlkioWeight(pid int) (uint64, error) {
+	cgroups, err := processCgroups(pid)
+	if err != nil {
+		return 0, err
+	}
+	var paths []string
+	if path, ok := cgroups["blkio"]; ok {
+		dir := filepath.Join(cgroupRoot, "blkio", domainCgroup(path))
+		paths = []string{filepath.Join(dir, "blkio.bfq.weight"), filepath.Join(dir, "blkio.weight")}
+	} else if path, ok := cgroups[""]; ok {
+		dir := filepath.Join(cgroupRoot, domainCgroup(path))
+		paths = []string{filepath.Join(dir, "io.bfq.weight"), filepath.Join(dir, "io.weight")}
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "default" {
+				fields = fields[1:]
+			}
+			if len(fields) == 1 {
+				return strconv.ParseUint(fields[0], 10, 64)
+			}
+		}
+		return 0, fmt.Errorf("no weight found in %s", path)
+	}
+	return 0, fmt.Errorf("no I/O weight found in cgroups of process %d", pid)
+}
@@ -0,0 +1,31 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package collector
+
+import (
+	"errors"
+)
+
+// readCgroupStats fails, as cgroups only exist on Linux.
+func readCgroupStats(pid int) (*cgroupStats, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+// readCgroupBlkioWeight fails, as cgroups only exist on Linux.
+func readCgroupBlkioWeight(pid int) (uint64, error) {
+	return 0, errors.New("cgroups are only supported on Linux")
+}
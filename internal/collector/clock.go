@@ -0,0 +1,50 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainClock reports the configuration of the clock of a domain
+// and of its timers, as found in the <clock> element of its XML
+// description, as misconfigured timers are a common cause of guest time
+// drift. Like other configuration, it is reported for inactive domains as
+// well.
+func (e *LibvirtExporter) CollectDomainClock(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	clock := &desc.Clock
+	ch <- infoMetric(
+		e.libvirtDomainClockInfoDesc,
+		append(domainLabelValues, clock.Offset, clock.Basis, clock.Timezone)...)
+
+	// The adjustment of variable clocks may be "reset", which is not an
+	// offset.
+	if adjustment, err := strconv.ParseInt(clock.Adjustment, 10, 64); err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainClockAdjustmentDesc,
+			prometheus.GaugeValue,
+			float64(adjustment),
+			domainLabelValues...)
+	}
+
+	for _, timer := range clock.Timers {
+		ch <- infoMetric(
+			e.libvirtDomainClockTimerInfoDesc,
+			append(domainLabelValues, timer.Name, timer.Present, timer.TickPolicy, timer.Track, timer.Mode, timer.Frequency)...)
+	}
+}
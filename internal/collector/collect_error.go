@@ -0,0 +1,54 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+// collectError is returned when collecting metrics from libvirt fails,
+// recording the stage of the collection at which the failure occurred.
+type collectError struct {
+	stage string
+	err   error
+}
+
+func (e *collectError) Error() string {
+	return e.err.Error()
+}
+
+// FormatErrorComment describes a collection failure as a comment of the
+// text exposition format, with machine-readable fields. The code and
+// error_domain fields hold the numeric virErrorNumber and virErrorDomain
+// reported by libvirt, if any. The uri field is only added if uri is not
+// empty.
+func FormatErrorComment(err error, uri string) string {
+	stage, code, errorDomain := "unknown", "unknown", "unknown"
+	if ce, ok := err.(*collectError); ok {
+		stage = ce.stage
+		err = ce.err
+	}
+	if lverr, ok := err.(libvirt.Error); ok {
+		code = strconv.Itoa(int(lverr.Code))
+		errorDomain = strconv.Itoa(int(lverr.Domain))
+	}
+	comment := fmt.Sprintf("# ERROR stage=%s code=%s error_domain=%s message=%q", stage, code, errorDomain, err.Error())
+	if uri != "" {
+		comment += fmt.Sprintf(" uri=%q", uri)
+	}
+	return comment + "\n"
+}
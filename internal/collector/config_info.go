@@ -0,0 +1,58 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configInfoLabels lists the labels of libvirt_exporter_config_info.
+var configInfoLabels = []string{"collectors", "collector_intervals", "domain_filter", "domain_uuid_file", "include_inactive", "block_source_label", "max_concurrent_collects", "hash"}
+
+// configInfoLabelValues returns the values of the labels of
+// libvirt_exporter_config_info, which summarize the options of an
+// exporter, so that differences between hosts are visible in Prometheus.
+func configInfoLabelValues(opts LibvirtExporterOptions) []string {
+	var collectors []string
+	for _, name := range OptionalCollectorNames {
+		if !opts.DisabledCollectors[name] {
+			collectors = append(collectors, name)
+		}
+	}
+	var intervals []string
+	for name, interval := range opts.CollectorIntervals {
+		intervals = append(intervals, name+"="+interval.String())
+	}
+	sort.Strings(intervals)
+	domainFilter := ""
+	if opts.DomainFilter != nil {
+		domainFilter = opts.DomainFilter.String()
+	}
+	domainUUIDFile := ""
+	if opts.DomainUUIDs != nil {
+		domainUUIDFile = opts.DomainUUIDs.path
+	}
+	return []string{
+		strings.Join(collectors, ","),
+		strings.Join(intervals, ","),
+		domainFilter,
+		domainUUIDFile,
+		strconv.FormatBool(opts.IncludeInactive),
+		opts.BlockSourceLabel,
+		strconv.Itoa(opts.MaxConcurrentCollects),
+		opts.ConfigHash,
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainCPUTopology reports the topology of the virtual CPUs of a
+// domain, in sockets, dies, cores and threads, which software licensed
+// per socket or per core is counted on. Nothing is reported for domains
+// without a configured topology, whose topology is chosen by the
+// hypervisor depending on the machine type.
+func (e *LibvirtExporter) CollectDomainCPUTopology(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	topology := desc.CPU.Topology
+	if topology == nil {
+		return
+	}
+	dies := topology.Dies
+	if dies == 0 {
+		dies = 1
+	}
+	for _, m := range []struct {
+		desc  *prometheus.Desc
+		value uint
+	}{
+		{e.libvirtDomainCPUSocketsDesc, topology.Sockets},
+		{e.libvirtDomainCPUDiesDesc, dies},
+		{e.libvirtDomainCPUCoresDesc, topology.Cores},
+		{e.libvirtDomainCPUThreadsDesc, topology.Threads},
+	} {
+		ch <- prometheus.MustNewConstMetric(m.desc, prometheus.GaugeValue, float64(m.value), domainLabelValues...)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// secretAttributeRegexp matches XML attributes that may hold credentials,
+// such as the VNC/SPICE passwords of <graphics> devices.
+var secretAttributeRegexp = regexp.MustCompile(`\s(passwd|password)=("[^"]*"|'[^']*')`)
+
+// sanitizeDomainXML removes credentials from the XML description of a
+// domain, so that it can be shown on a debug endpoint.
+func sanitizeDomainXML(xmlDesc string) string {
+	return secretAttributeRegexp.ReplaceAllString(xmlDesc, "")
+}
+
+// ServeDomainXML shows the sanitized XML description of a domain, as
+// parsed by the exporter, together with the label values derived from it.
+func (e *LibvirtExporter) ServeDomainXML(w http.ResponseWriter, domainName string) {
+	conn, err := e.connect()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer conn.Close()
+
+	domain, err := conn.LookupDomainByName(domainName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer domain.Free()
+
+	xmlDesc, err := domain.GetXMLDesc(0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var desc libvirt_schema.Domain
+	parseErr := xml.Unmarshal([]byte(xmlDesc), &desc)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "# Domain labels\n")
+	for i, value := range e.domainLabelValues(domainName, &desc) {
+		fmt.Fprintf(w, "%s=%q\n", e.domainLabels[i], value)
+	}
+	fmt.Fprintf(w, "\n# Block device labels\n")
+	for _, disk := range desc.Devices.Disks {
+		fmt.Fprintf(w, "device=%q source_file=%q target_device=%q source=%q disk_type=%q driver_type=%q (file=%q dev=%q volume=%q serial=%q alias=%q)\n",
+			disk.Device, e.blockSourceLabelValue(&disk), disk.Target.Device, disk.SourceName(), disk.Type, disk.Driver.Type,
+			disk.Source.File, disk.Source.Dev, disk.Source.Volume, disk.Serial, disk.Alias.Name)
+	}
+	fmt.Fprintf(w, "\n# Network interface labels\n")
+	for _, iface := range desc.Devices.Interfaces {
+		fmt.Fprintf(w, "source_bridge=%q target_device=%q\n", iface.Source.Bridge, iface.Target.Device)
+	}
+	fmt.Fprintf(w, "\n# Unknown fields\n")
+	for _, field := range desc.UnknownFields() {
+		fmt.Fprintf(w, "%s\n", field)
+	}
+	if parseErr != nil {
+		fmt.Fprintf(w, "\n# Parse error\n%s\n", parseErr)
+	}
+	fmt.Fprintf(w, "\n# XML description\n%s\n", sanitizeDomainXML(xmlDesc))
+}
@@ -0,0 +1,30 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+// Deprecation describes a deprecated metric family.
+type Deprecation struct {
+	// Replacement is the name of the family replacing the deprecated
+	// one, if any.
+	Replacement string
+	// Removal is the release in which the family will stop being
+	// exported.
+	Removal string
+}
+
+// DeprecatedFamilies maps the names of deprecated metric families to their
+// deprecation. When a family is renamed, both names are exported for at
+// least one release, the old one being listed here, so that dashboards
+// and alerts can be migrated before it is removed.
+var DeprecatedFamilies = map[string]Deprecation{}
@@ -0,0 +1,99 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// Classes of devices, depending on how they are implemented by the
+// hypervisor.
+const (
+	deviceClassParavirtual = "paravirtual"
+	deviceClassEmulated    = "emulated"
+	deviceClassPassthrough = "passthrough"
+)
+
+// diskDeviceClass returns the class of a disk, depending on its bus. Disks
+// on a SCSI bus are paravirtual if their controller is a virtio-scsi
+// controller.
+func diskDeviceClass(disk *libvirt_schema.Disk, controllers []libvirt_schema.Controller) string {
+	switch disk.Target.Bus {
+	case "virtio", "xen":
+		return deviceClassParavirtual
+	case "scsi":
+		index := "0"
+		if disk.Address != nil && disk.Address.Type == "drive" && disk.Address.Controller != "" {
+			index = disk.Address.Controller
+		}
+		for _, controller := range controllers {
+			controllerIndex := controller.Index
+			if controllerIndex == "" {
+				controllerIndex = "0"
+			}
+			if controller.Type == "scsi" && controllerIndex == index && strings.HasPrefix(controller.Model, "virtio") {
+				return deviceClassParavirtual
+			}
+		}
+	}
+	return deviceClassEmulated
+}
+
+// interfaceDeviceClass returns the class of a network interface,
+// depending on its model. Interfaces without a model are given the default
+// model of the machine, which is emulated.
+func interfaceDeviceClass(iface *libvirt_schema.Interface) string {
+	switch {
+	case iface.Type == "hostdev":
+		return deviceClassPassthrough
+	case strings.HasPrefix(iface.Model.Type, "virtio"), iface.Model.Type == "netfront":
+		return deviceClassParavirtual
+	}
+	return deviceClassEmulated
+}
+
+// CollectDomainDevices reports the number of disks and network interfaces
+// of a domain by model and class, so that domains still using emulated
+// devices such as IDE disks or e1000 interfaces, which are slower than
+// virtio devices, can be found and migrated.
+func (e *LibvirtExporter) CollectDomainDevices(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	type deviceKey struct {
+		kind, model, class string
+	}
+	counts := map[deviceKey]int{}
+	for i := range desc.Devices.Disks {
+		disk := &desc.Devices.Disks[i]
+		kind := disk.Device
+		if kind == "" {
+			kind = "disk"
+		}
+		counts[deviceKey{kind, disk.Target.Bus, diskDeviceClass(disk, desc.Devices.Controllers)}]++
+	}
+	for i := range desc.Devices.Interfaces {
+		iface := &desc.Devices.Interfaces[i]
+		counts[deviceKey{"interface", iface.Model.Type, interfaceDeviceClass(iface)}]++
+	}
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainDevicesDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			append(domainLabelValues, key.kind, key.model, key.class)...)
+	}
+}
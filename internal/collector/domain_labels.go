@@ -0,0 +1,90 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// labelNameRE matches the label names accepted by Prometheus, excluding
+// those reserved for internal use.
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// mapDomainLabels renames and drops labels attached to all metrics of a
+// domain. It returns the names of the remaining labels, with the indexes
+// of their values among those of the original labels, or nil if no label
+// is dropped. The domain label identifies domains, so it cannot be
+// dropped.
+func mapDomainLabels(labels []string, renames map[string]string, dropped map[string]bool) ([]string, []int, error) {
+	known := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		known[label] = true
+	}
+	for label := range renames {
+		if !known[label] {
+			return nil, nil, fmt.Errorf("invalid domain label %q to rename, must be one of %s", label, strings.Join(labels, ", "))
+		}
+	}
+	for label := range dropped {
+		if !known[label] {
+			return nil, nil, fmt.Errorf("invalid domain label %q to drop, must be one of %s", label, strings.Join(labels, ", "))
+		}
+		if label == "domain" {
+			return nil, nil, fmt.Errorf("the domain label cannot be dropped")
+		}
+	}
+
+	var (
+		names []string
+		kept  []int
+		seen  = map[string]bool{}
+	)
+	for i, label := range labels {
+		if dropped[label] {
+			continue
+		}
+		name := label
+		if renamed, ok := renames[label]; ok {
+			if !labelNameRE.MatchString(renamed) || strings.HasPrefix(renamed, "__") {
+				return nil, nil, fmt.Errorf("invalid name %q for domain label %s", renamed, label)
+			}
+			name = renamed
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("duplicate domain label %s", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+		kept = append(kept, i)
+	}
+	if len(dropped) == 0 {
+		kept = nil
+	}
+	return names, kept, nil
+}
+
+// keepLabelValues returns the values at the given indexes, or all values
+// if indexes is nil.
+func keepLabelValues(values []string, indexes []int) []string {
+	if indexes == nil {
+		return values
+	}
+	kept := make([]string, len(indexes))
+	for i, index := range indexes {
+		kept[i] = values[index]
+	}
+	return kept
+}
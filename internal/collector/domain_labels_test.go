@@ -0,0 +1,64 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapDomainLabels(t *testing.T) {
+	t.Parallel()
+	labels := []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}
+	tests := []struct {
+		name    string
+		renames map[string]string
+		dropped map[string]bool
+		want    []string
+		kept    []int
+		valid   bool
+	}{
+		{"none", nil, nil, labels, nil, true},
+		{"rename", map[string]string{"resource_id": "uuid", "name": "instance_name"}, nil, []string{"domain", "uuid", "instance_name", "flavor", "user_id", "project_id"}, nil, true},
+		{"drop", nil, map[string]bool{"flavor": true, "user_id": true}, []string{"domain", "resource_id", "name", "project_id"}, []int{0, 1, 2, 5}, true},
+		{"rename and drop", map[string]string{"name": "flavor"}, map[string]bool{"flavor": true}, []string{"domain", "resource_id", "flavor", "user_id", "project_id"}, []int{0, 1, 2, 4, 5}, true},
+		{"unknown rename", map[string]string{"uuid": "id"}, nil, nil, nil, false},
+		{"unknown drop", nil, map[string]bool{"uuid": true}, nil, nil, false},
+		{"drop domain", nil, map[string]bool{"domain": true}, nil, nil, false},
+		{"invalid name", map[string]string{"name": "instance-name"}, nil, nil, nil, false},
+		{"reserved name", map[string]string{"name": "__name__"}, nil, nil, nil, false},
+		{"duplicate name", map[string]string{"name": "flavor"}, nil, nil, nil, false},
+	}
+	for _, test := range tests {
+		names, kept, err := mapDomainLabels(labels, test.renames, test.dropped)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(names, test.want) || !reflect.DeepEqual(kept, test.kept) {
+			t.Errorf("%s: got labels %v kept at %v, want %v kept at %v", test.name, names, kept, test.want, test.kept)
+		}
+	}
+
+	values := keepLabelValues([]string{"vm", "uuid", "name", "flavor", "user", "project"}, []int{0, 1, 2, 5})
+	if want := []string{"vm", "uuid", "name", "project"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("Got label values %v, want %v", values, want)
+	}
+}
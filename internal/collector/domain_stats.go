@@ -0,0 +1,225 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/libvirt/libvirt-go"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// isNoSupport returns whether an error indicates that libvirt does not
+// support the requested API call.
+func isNoSupport(err error) bool {
+	lverr, ok := err.(libvirt.Error)
+	return ok && lverr.Code == libvirt.ERR_NO_SUPPORT
+}
+
+// isNoDomain returns whether an error indicates that a domain no longer
+// exists, which happens when transient domains disappear during a scrape.
+func isNoDomain(err error) bool {
+	lverr, ok := err.(libvirt.Error)
+	return ok && lverr.Code == libvirt.ERR_NO_DOMAIN
+}
+
+// findBlockStats returns the statistics of the block device with the
+// given target name, or nil if there are none.
+func findBlockStats(stats *libvirt.DomainStats, name string) *libvirt.DomainStatsBlock {
+	for i := range stats.Block {
+		// Only the top of the backing chain of each disk is of interest.
+		if stats.Block[i].Name == name && !stats.Block[i].BackingIndexSet {
+			return &stats.Block[i]
+		}
+	}
+	return nil
+}
+
+// findNetStats returns the statistics of the network interface with the
+// given target name, or nil if there are none.
+func findNetStats(stats *libvirt.DomainStats, name string) *libvirt.DomainStatsNet {
+	for i := range stats.Net {
+		if stats.Net[i].Name == name {
+			return &stats.Net[i]
+		}
+	}
+	return nil
+}
+
+// legacyDomainStats obtains the statistics of a domain through individual
+// API calls, in the same form as returned by GetAllDomainStats(). It is
+// used with libvirt versions that lack GetAllDomainStats(). Failing to
+// obtain the statistics of a device is not fatal: the error is reported
+// and the device is omitted.
+func (e *LibvirtExporter) legacyDomainStats(domain *libvirt.Domain, domainName string, desc *libvirt_schema.Domain) (*libvirt.DomainStats, error) {
+	info, err := domain.GetInfo()
+	if err != nil {
+		e.countError("virDomainGetInfo", err)
+		return nil, err
+	}
+	stats := &libvirt.DomainStats{
+		Domain: domain,
+		State: &libvirt.DomainStatsState{
+			StateSet: true,
+			State:    info.State,
+		},
+		Cpu: &libvirt.DomainStatsCPU{
+			TimeSet: true,
+			Time:    info.CpuTime,
+		},
+		Balloon: &libvirt.DomainStatsBalloon{
+			CurrentSet: true,
+			Current:    info.Memory,
+			MaximumSet: true,
+			Maximum:    info.MaxMem,
+		},
+	}
+	// Device, virtual CPU and memory statistics are only available while
+	// the domain is running.
+	if info.State == libvirt.DOMAIN_SHUTOFF {
+		return stats, nil
+	}
+
+	if !e.disabled["vcpustats"] {
+		vcpus, err := domain.GetVcpus()
+		if err != nil {
+			e.countError("virDomainGetVcpus", err)
+			return nil, err
+		}
+		for _, vcpu := range vcpus {
+			for uint32(len(stats.Vcpu)) <= vcpu.Number {
+				stats.Vcpu = append(stats.Vcpu, libvirt.DomainStatsVcpu{})
+			}
+			stats.Vcpu[vcpu.Number] = libvirt.DomainStatsVcpu{
+				StateSet: true,
+				State:    libvirt.VcpuState(vcpu.State),
+				TimeSet:  true,
+				Time:     vcpu.CpuTime,
+			}
+		}
+	}
+
+	if !e.disabled["memorystats"] {
+		memoryStats, err := domain.MemoryStats(uint32(libvirt.DOMAIN_MEMORY_STAT_NR), 0)
+		if err != nil {
+			e.countError("virDomainMemoryStats", err)
+			return nil, err
+		}
+		balloon := stats.Balloon
+		for _, stat := range memoryStats {
+			switch libvirt.DomainMemoryStatTags(stat.Tag) {
+			case libvirt.DOMAIN_MEMORY_STAT_ACTUAL_BALLOON:
+				balloon.CurrentSet, balloon.Current = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_AVAILABLE:
+				balloon.AvailableSet, balloon.Available = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_UNUSED:
+				balloon.UnusedSet, balloon.Unused = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_USABLE:
+				balloon.UsableSet, balloon.Usable = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_RSS:
+				balloon.RssSet, balloon.Rss = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_DISK_CACHES:
+				balloon.DiskCachesSet, balloon.DiskCaches = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_SWAP_IN:
+				balloon.SwapInSet, balloon.SwapIn = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_SWAP_OUT:
+				balloon.SwapOutSet, balloon.SwapOut = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_MAJOR_FAULT:
+				balloon.MajorFaultSet, balloon.MajorFault = true, stat.Val
+			case libvirt.DOMAIN_MEMORY_STAT_MINOR_FAULT:
+				balloon.MinorFaultSet, balloon.MinorFault = true, stat.Val
+			}
+		}
+	}
+
+	for _, disk := range desc.Devices.Disks {
+		if disk.Device == "cdrom" || disk.Device == "fd" || e.disabled["blockstats"] {
+			continue
+		}
+		blockStats, err := domain.BlockStats(disk.Target.Device)
+		if err != nil {
+			e.countError("virDomainBlockStats", err)
+			e.logger.Printf("Failed to obtain statistics of block device %s of domain %s: %s", disk.Target.Device, domainName, err)
+			e.libvirtDomainScrapeErrors.WithLabelValues(domainName).Inc()
+			continue
+		}
+		block := libvirt.DomainStatsBlock{
+			NameSet:    true,
+			Name:       disk.Target.Device,
+			RdBytesSet: blockStats.RdBytesSet,
+			RdBytes:    uint64(blockStats.RdBytes),
+			RdReqsSet:  blockStats.RdReqSet,
+			RdReqs:     uint64(blockStats.RdReq),
+			RdTimesSet: blockStats.RdTotalTimesSet,
+			RdTimes:    uint64(blockStats.RdTotalTimes),
+			WrBytesSet: blockStats.WrBytesSet,
+			WrBytes:    uint64(blockStats.WrBytes),
+			WrReqsSet:  blockStats.WrReqSet,
+			WrReqs:     uint64(blockStats.WrReq),
+			WrTimesSet: blockStats.WrTotalTimesSet,
+			WrTimes:    uint64(blockStats.WrTotalTimes),
+			FlReqsSet:  blockStats.FlushReqSet,
+			FlReqs:     uint64(blockStats.FlushReq),
+			FlTimesSet: blockStats.FlushTotalTimesSet,
+			FlTimes:    uint64(blockStats.FlushTotalTimes),
+			ErrorsSet:  blockStats.ErrsSet,
+			Errors:     uint64(blockStats.Errs),
+		}
+		blockInfo, err := domain.GetBlockInfo(disk.Target.Device, 0)
+		if err != nil {
+			e.countError("virDomainGetBlockInfo", err)
+			e.logger.Printf("Failed to obtain size of block device %s of domain %s: %s", disk.Target.Device, domainName, err)
+			e.libvirtDomainScrapeErrors.WithLabelValues(domainName).Inc()
+		} else {
+			block.CapacitySet, block.Capacity = true, blockInfo.Capacity
+			block.AllocationSet, block.Allocation = true, blockInfo.Allocation
+			block.PhysicalSet, block.Physical = true, blockInfo.Physical
+		}
+		stats.Block = append(stats.Block, block)
+	}
+
+	for _, iface := range desc.Devices.Interfaces {
+		if iface.Target.Device == "" || e.disabled["netstats"] {
+			continue
+		}
+		interfaceStats, err := domain.InterfaceStats(iface.Target.Device)
+		if err != nil {
+			e.countError("virDomainInterfaceStats", err)
+			e.logger.Printf("Failed to obtain statistics of network interface %s of domain %s: %s", iface.Target.Device, domainName, err)
+			e.libvirtDomainScrapeErrors.WithLabelValues(domainName).Inc()
+			continue
+		}
+		stats.Net = append(stats.Net, libvirt.DomainStatsNet{
+			NameSet:    true,
+			Name:       iface.Target.Device,
+			RxBytesSet: interfaceStats.RxBytesSet,
+			RxBytes:    uint64(interfaceStats.RxBytes),
+			RxPktsSet:  interfaceStats.RxPacketsSet,
+			RxPkts:     uint64(interfaceStats.RxPackets),
+			RxErrsSet:  interfaceStats.RxErrsSet,
+			RxErrs:     uint64(interfaceStats.RxErrs),
+			RxDropSet:  interfaceStats.RxDropSet,
+			RxDrop:     uint64(interfaceStats.RxDrop),
+			TxBytesSet: interfaceStats.TxBytesSet,
+			TxBytes:    uint64(interfaceStats.TxBytes),
+			TxPktsSet:  interfaceStats.TxPacketsSet,
+			TxPkts:     uint64(interfaceStats.TxPackets),
+			TxErrsSet:  interfaceStats.TxErrsSet,
+			TxErrs:     uint64(interfaceStats.TxErrs),
+			TxDropSet:  interfaceStats.TxDropSet,
+			TxDrop:     uint64(interfaceStats.TxDrop),
+		})
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// domainEventsRetryInterval is the delay before watching the events of a
+// URI again after its connection was lost.
+const domainEventsRetryInterval = 10 * time.Second
+
+// StartEventLoop registers and runs the default event loop of libvirt,
+// which must be done before opening the connections whose events are
+// watched.
+func StartEventLoop() error {
+	if err := libvirt.EventRegisterDefaultImpl(); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			if err := libvirt.EventRunDefaultImpl(); err != nil {
+				log.Printf("Failed to run libvirt event loop: %s", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// domainDefinitionEvents maps the details of the lifecycle events sent
+// when the definition of a domain changes to the values of the event and
+// detail labels.
+var domainDefinitionEvents = map[libvirt.DomainEventType]map[int][2]string{
+	libvirt.DOMAIN_EVENT_DEFINED: {
+		int(libvirt.DOMAIN_EVENT_DEFINED_ADDED):         {"defined", "added"},
+		int(libvirt.DOMAIN_EVENT_DEFINED_UPDATED):       {"defined", "updated"},
+		int(libvirt.DOMAIN_EVENT_DEFINED_RENAMED):       {"defined", "renamed"},
+		int(libvirt.DOMAIN_EVENT_DEFINED_FROM_SNAPSHOT): {"defined", "from_snapshot"},
+	},
+	libvirt.DOMAIN_EVENT_UNDEFINED: {
+		int(libvirt.DOMAIN_EVENT_UNDEFINED_REMOVED): {"undefined", "removed"},
+		int(libvirt.DOMAIN_EVENT_UNDEFINED_RENAMED): {"undefined", "renamed"},
+	},
+}
+
+// domainEvents records the changes of the definition of domains, as
+// reported by libvirt events.
+type domainEvents struct {
+	mu      sync.Mutex
+	changes map[[2]string]int
+	changed map[string]time.Time
+}
+
+func newDomainEvents() *domainEvents {
+	return &domainEvents{
+		changes: map[[2]string]int{},
+		changed: map[string]time.Time{},
+	}
+}
+
+// record records a change of the definition of the domain with the given
+// UUID.
+func (d *domainEvents) record(uuid string, event [2]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.changes[event]++
+	if event[0] == "undefined" {
+		delete(d.changed, uuid)
+	} else {
+		d.changed[uuid] = time.Now()
+	}
+}
+
+// changedAt returns when the definition of the domain with the given UUID
+// last changed since events have been watched.
+func (d *domainEvents) changedAt(uuid string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed, ok := d.changed[uuid]
+	return changed, ok
+}
+
+// CollectDomainEvents reports the number of changes of the definition of
+// domains since the events of the URI have been watched.
+func (e *LibvirtExporter) CollectDomainEvents(ch chan<- prometheus.Metric) {
+	e.domainEvents.mu.Lock()
+	defer e.domainEvents.mu.Unlock()
+	for event, count := range e.domainEvents.changes {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainConfigChangesDesc,
+			prometheus.CounterValue,
+			float64(count),
+			event[0], event[1])
+	}
+}
+
+// watchDomainEvents records the changes of the definition of domains
+// until stop is closed, reconnecting to libvirt when the connection is
+// lost.
+func (e *LibvirtExporter) watchDomainEvents(stop <-chan struct{}) {
+	for {
+		err := e.watchDomainEventsOnce(stop)
+		if err == nil {
+			return
+		}
+		e.logger.Printf("Failed to watch domain events of %s: %s", e.uri, err)
+		select {
+		case <-time.After(domainEventsRetryInterval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// watchDomainEventsOnce records the changes of the definition of domains
+// over a dedicated connection, as connections of the pool may be closed
+// at any time. It returns nil once stop is closed, or an error if the
+// connection is lost.
+func (e *LibvirtExporter) watchDomainEventsOnce(stop <-chan struct{}) error {
+	conn, err := libvirt.NewConnect(e.uri)
+	if err != nil {
+		e.countError("virConnectOpen", err)
+		return err
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	var closeOnce sync.Once
+	err = conn.RegisterCloseCallback(func(conn *libvirt.Connect, reason libvirt.ConnectCloseReason) {
+		closeOnce.Do(func() { close(closed) })
+	})
+	if err != nil {
+		e.countError("virConnectRegisterCloseCallback", err)
+		return err
+	}
+	defer conn.UnregisterCloseCallback()
+
+	callbackID, err := conn.DomainEventLifecycleRegister(nil, func(conn *libvirt.Connect, domain *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+		change, ok := domainDefinitionEvents[event.Event][event.Detail]
+		if !ok {
+			return
+		}
+		uuid, err := domain.GetUUIDString()
+		if err != nil {
+			e.countError("virDomainGetUUIDString", err)
+			return
+		}
+		e.domainEvents.record(uuid, change)
+	})
+	if err != nil {
+		e.countError("virConnectDomainEventRegisterAny", err)
+		return err
+	}
+	defer conn.DomainEventDeregister(callbackID)
+
+	select {
+	case <-stop:
+		return nil
+	case <-closed:
+		return errors.New("connection closed")
+	}
+}
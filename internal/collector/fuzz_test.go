@@ -0,0 +1,35 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// FuzzPreviewDomain derives metrics from arbitrary domain descriptions,
+// which exercises the same code as the collection of a domain whose
+// description was altered by a compromised guest or host. Descriptions
+// may fail to parse, but must never cause a panic.
+func FuzzPreviewDomain(f *testing.F) {
+	f.Add([]byte(`<domain type='kvm'><name>test</name><uuid>6695eb01-f6a4-8304-79aa-97f2502e193f</uuid><vcpu>2</vcpu>` +
+		`<devices><disk type='file' device='disk'><source file='/var/lib/disk'/><target dev='vda' bus='virtio'/></disk>` +
+		`<interface type='bridge'><source bridge='br0'/><target dev='tap0'/><filterref filter='clean-traffic'/></interface>` +
+		`<graphics type='spice' port='-1' autoport='yes'/><tpm model='tpm-crb'><backend type='emulator' version='2.0'/></tpm></devices></domain>`))
+	f.Add([]byte(`<domain><devices><shmem name='s'><size unit='E'>16</size></shmem></devices></domain>`))
+	e := newTestExporter(f, testURI)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e.PreviewDomain(ioutil.Discard, data)
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+	"strconv"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainGraphics reports the VNC and SPICE servers of a domain, as
+// found in its XML description.
+func (e *LibvirtExporter) CollectDomainGraphics(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for i := range desc.Devices.Graphics {
+		graphics := &desc.Devices.Graphics[i]
+		if graphics.Type != "vnc" && graphics.Type != "spice" {
+			continue
+		}
+		ch <- infoMetric(
+			e.libvirtDomainGraphicsInfoDesc,
+			append(domainLabelValues, graphics.Type, graphics.Port, graphics.TLSPort, graphics.ListenAddress(), graphics.AutoPort)...)
+	}
+}
+
+// graphicsPortClaim is a TCP port on which the graphics server of a
+// domain listens.
+type graphicsPortClaim struct {
+	domain string
+	listen string
+}
+
+// isWildcardAddress returns whether an address designates all the
+// addresses of the host.
+func isWildcardAddress(address string) bool {
+	return address == "" || address == "0.0.0.0" || address == "::"
+}
+
+// graphicsPortConflicts returns the number of ports claimed by the
+// graphics servers of different domains on overlapping addresses.
+func graphicsPortConflicts(claims map[int][]graphicsPortClaim) int {
+	conflicts := 0
+	for _, portClaims := range claims {
+	search:
+		for i := range portClaims {
+			for j := i + 1; j < len(portClaims); j++ {
+				a, b := portClaims[i], portClaims[j]
+				if a.domain != b.domain && (a.listen == b.listen || isWildcardAddress(a.listen) || isWildcardAddress(b.listen)) {
+					conflicts++
+					break search
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// CollectHostGraphics checks the TCP ports of the VNC and SPICE servers
+// of the active domains of the host, reporting ports claimed by several
+// domains and servers whose port could not be allocated. Both break
+// access to the console of domains, typically after migrations.
+func (e *LibvirtExporter) CollectHostGraphics(ch chan<- prometheus.Metric, conn *libvirt.Connect) error {
+	doms, err := conn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		e.countError("virConnectListAllDomains", err)
+		return err
+	}
+	claims := map[int][]graphicsPortClaim{}
+	autoportFailures := 0
+	for i := range doms {
+		xmlDesc, err := doms[i].GetXMLDesc(0)
+		doms[i].Free()
+		if err != nil {
+			// Domains may stop while they are being listed.
+			e.countError("virDomainGetXMLDesc", err)
+			continue
+		}
+		var desc libvirt_schema.Domain
+		// Whatever could be extracted from a description that fails
+		// to parse is still used.
+		xml.Unmarshal([]byte(xmlDesc), &desc)
+		for j := range desc.Devices.Graphics {
+			graphics := &desc.Devices.Graphics[j]
+			if (graphics.Type != "vnc" && graphics.Type != "spice") || !graphics.ListensOnTCP() {
+				continue
+			}
+			allocated := false
+			for _, value := range []string{graphics.Port, graphics.TLSPort} {
+				if port, err := strconv.Atoi(value); err == nil && port > 0 {
+					claims[port] = append(claims[port], graphicsPortClaim{desc.UUID, graphics.ListenAddress()})
+					allocated = true
+				}
+			}
+			if !allocated {
+				autoportFailures++
+			}
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostGraphicsPortsDesc,
+		prometheus.GaugeValue,
+		float64(len(claims)))
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostGraphicsPortConflictsDesc,
+		prometheus.GaugeValue,
+		float64(graphicsPortConflicts(claims)))
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostGraphicsUnallocatedDesc,
+		prometheus.GaugeValue,
+		float64(autoportFailures))
+	return nil
+}
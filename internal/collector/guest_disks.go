@@ -0,0 +1,132 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// GuestDisk maps a disk of a domain, as known by the hypervisor, to the
+// device it appears as in the guest.
+type GuestDisk struct {
+	TargetDevice string `json:"target_device"`
+	SourceFile   string `json:"source_file"`
+	Serial       string `json:"serial"`
+	GuestDevice  string `json:"guest_device"`
+	// GuestAlias is the alias of the device in the guest, such as the
+	// name of a Windows volume, if any.
+	GuestAlias string `json:"guest_alias,omitempty"`
+}
+
+// guestDisks returns the disks of a running domain mapped to the devices
+// they appear as in the guest, as reported by the QEMU guest agent, which
+// matches them by serial number or address. Partitions and disks of the
+// guest that the agent could not match are left out.
+func (e *LibvirtExporter) guestDisks(domain *libvirt.Domain, desc *libvirt_schema.Domain) ([]GuestDisk, error) {
+	info, err := domain.GetGuestInfo(libvirt.DOMAIN_GUEST_INFO_DISKS, 0)
+	if err != nil {
+		e.countError("virDomainGetGuestInfo", err)
+		return nil, err
+	}
+	var disks []GuestDisk
+	for _, guestDisk := range info.Disks {
+		if guestDisk.Partition || !guestDisk.AliasSet {
+			continue
+		}
+		// The alias reported by the agent is the target device of the
+		// disk, such as vda.
+		for i := range desc.Devices.Disks {
+			disk := &desc.Devices.Disks[i]
+			if disk.Target.Device != guestDisk.Alias {
+				continue
+			}
+			disks = append(disks, GuestDisk{
+				TargetDevice: disk.Target.Device,
+				SourceFile:   e.blockSourceLabelValue(disk),
+				Serial:       disk.Serial,
+				GuestDevice:  guestDisk.Name,
+				GuestAlias:   guestDisk.GuestAlias,
+			})
+			break
+		}
+	}
+	return disks, nil
+}
+
+// CollectDomainGuestDisks reports the devices the disks of a running
+// domain appear as in the guest, such as /dev/sdb, so that storage issues
+// reported from inside the guest can be traced to the disk backing them
+// on the host, and the other way around. It requires the QEMU guest agent
+// to run in the guest, and is skipped otherwise.
+func (e *LibvirtExporter) CollectDomainGuestDisks(ch chan<- prometheus.Metric, domain *libvirt.Domain, domainName string, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	disks, err := e.guestDisks(domain, desc)
+	if err != nil {
+		if !isNoSupport(err) {
+			e.logger.Printf("Failed to obtain guest disks of domain %s: %s", domainName, err)
+		}
+		return
+	}
+	for _, disk := range disks {
+		ch <- infoMetric(
+			e.libvirtDomainBlockGuestDeviceDesc,
+			append(domainLabelValues, disk.SourceFile, disk.TargetDevice, disk.Serial, disk.GuestDevice)...)
+	}
+}
+
+// ServeDomainGuestDisks shows the disks of a running domain mapped to the
+// devices they appear as in the guest, as a JSON array.
+func (e *LibvirtExporter) ServeDomainGuestDisks(w http.ResponseWriter, domainName string) {
+	conn, err := e.connect()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer conn.Close()
+
+	domain, err := conn.LookupDomainByName(domainName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer domain.Free()
+
+	xmlDesc, err := domain.GetXMLDesc(0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var desc libvirt_schema.Domain
+	if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	disks, err := e.guestDisks(domain, &desc)
+	if err != nil {
+		// The guest agent is not running, or the domain is not.
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if disks == nil {
+		disks = []GuestDisk{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(disks)
+}
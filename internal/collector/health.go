@@ -0,0 +1,39 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+// setReady marks the exporter as ready, after it connected to libvirt.
+func (e *LibvirtExporter) setReady() {
+	e.readyMu.Lock()
+	defer e.readyMu.Unlock()
+	e.ready = true
+}
+
+// Ready returns whether the exporter has connected to libvirt at least
+// once. Exporters that have not connected yet try to connect, so that
+// readiness does not depend on being scraped first.
+func (e *LibvirtExporter) Ready() bool {
+	e.readyMu.Lock()
+	ready := e.ready
+	e.readyMu.Unlock()
+	if ready {
+		return true
+	}
+	conn, err := e.connect()
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
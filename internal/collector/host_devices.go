@@ -0,0 +1,105 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// hostDeviceName returns the name of the host block device at a path,
+// following symbolic links such as those of /dev/mapper, /dev/<vg> and
+// /dev/disk/by-id, e.g. "dm-3" for an LVM logical volume. It is the name
+// used in /proc/diskstats, and in the device label of the disk metrics
+// of the node exporter.
+func hostDeviceName(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resolved, "/dev/") {
+		return "", fmt.Errorf("%s is not a device", resolved)
+	}
+	return filepath.Base(resolved), nil
+}
+
+// sysClassBlockDir is the directory of block devices and partitions in
+// sysfs.
+const sysClassBlockDir = "/sys/class/block"
+
+// multipathPaths returns the number of paths of the first multipath
+// device found in the stack of devices under a host device, such as an
+// LVM logical volume on top of a multipath device, and the number of
+// those whose SCSI device is running. ok is false if there is no
+// multipath device.
+func multipathPaths(device string) (total, active int, ok bool) {
+	slaves, err := ioutil.ReadDir(filepath.Join(sysClassBlockDir, device, "slaves"))
+	if err != nil {
+		return 0, 0, false
+	}
+	uuid, _ := ioutil.ReadFile(filepath.Join(sysClassBlockDir, device, "dm", "uuid"))
+	if !strings.HasPrefix(string(uuid), "mpath-") {
+		for _, slave := range slaves {
+			if total, active, ok := multipathPaths(slave.Name()); ok {
+				return total, active, true
+			}
+		}
+		return 0, 0, false
+	}
+	for _, slave := range slaves {
+		total++
+		state, err := ioutil.ReadFile(filepath.Join(sysClassBlockDir, slave.Name(), "device", "state"))
+		if err == nil && strings.TrimSpace(string(state)) == "running" {
+			active++
+		}
+	}
+	return total, active, true
+}
+
+// CollectDiskHostDevice reports the host block device backing a block
+// disk of a domain and, if it is a multipath device, the number of its
+// paths. Other types of disks are skipped.
+func (e *LibvirtExporter) CollectDiskHostDevice(ch chan<- prometheus.Metric, domainName string, domainLabelValues []string, disk *libvirt_schema.Disk) {
+	if disk.Type != "block" || disk.Source.Dev == "" {
+		return
+	}
+	device, err := hostDeviceName(disk.Source.Dev)
+	if err != nil {
+		e.logger.Printf("Failed to resolve host device of disk %s of domain %s: %s", disk.Target.Device, domainName, err)
+		return
+	}
+	blockLabelValues := append(domainLabelValues, e.blockSourceLabelValue(disk), disk.Target.Device)
+	ch <- infoMetric(
+		e.libvirtDomainBlockHostDeviceDesc,
+		append(blockLabelValues, device)...)
+
+	if total, active, ok := multipathPaths(device); ok {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainBlockMultipathPathsDesc,
+			prometheus.GaugeValue,
+			float64(total),
+			blockLabelValues...)
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainBlockMultipathActivePathsDesc,
+			prometheus.GaugeValue,
+			float64(active),
+			blockLabelValues...)
+	}
+}
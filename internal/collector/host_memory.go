@@ -0,0 +1,83 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// activeDomainsMemory returns the sums of the current balloon sizes and
+// of the maximum memory of the active domains of the host, in KiB.
+func (e *LibvirtExporter) activeDomainsMemory(conn *libvirt.Connect) (current, maximum uint64, err error) {
+	allStats, err := conn.GetAllDomainStats(nil, libvirt.DOMAIN_STATS_BALLOON, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE)
+	if err == nil {
+		for i := range allStats {
+			if balloon := allStats[i].Balloon; balloon != nil && balloon.CurrentSet && balloon.MaximumSet {
+				current += balloon.Current
+				maximum += balloon.Maximum
+			}
+			allStats[i].Domain.Free()
+		}
+		return current, maximum, nil
+	}
+	e.countError("virConnectGetAllDomainStats", err)
+	if !isNoSupport(err) {
+		return 0, 0, err
+	}
+
+	// Fall back to querying domains individually.
+	doms, err := conn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		e.countError("virConnectListAllDomains", err)
+		return 0, 0, err
+	}
+	for i := range doms {
+		info, err := doms[i].GetInfo()
+		doms[i].Free()
+		if err != nil {
+			// Domains may stop while they are being listed.
+			e.countError("virDomainGetInfo", err)
+			continue
+		}
+		current += info.Memory
+		maximum += info.MaxMem
+	}
+	return current, maximum, nil
+}
+
+// CollectHostMemoryHeadroom reports the memory committed to the active
+// domains of the host, and the memory that would remain free if all of
+// them grew their balloon to their maximum memory. This is a forecast
+// that autoscalers can use directly, without joining host and domain
+// metrics that may have been collected at different times. free is the
+// free memory of the host, in KiB.
+func (e *LibvirtExporter) CollectHostMemoryHeadroom(ch chan<- prometheus.Metric, conn *libvirt.Connect, free uint64) error {
+	current, maximum, err := e.activeDomainsMemory(conn)
+	if err != nil {
+		return err
+	}
+	// Memory is reported by libvirt in KiB.
+	for _, m := range []struct {
+		desc  *prometheus.Desc
+		value float64
+	}{
+		{e.libvirtHostDomainsMemoryBalloonDesc, float64(current) * 1024},
+		{e.libvirtHostDomainsMemoryMaximumDesc, float64(maximum) * 1024},
+		{e.libvirtHostMemoryHeadroomDesc, (float64(free) - float64(maximum) + float64(current)) * 1024},
+	} {
+		ch <- prometheus.MustNewConstMetric(m.desc, prometheus.GaugeValue, m.value)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// formatVersion formats a version number as returned by libvirt, i.e.
+// major * 1,000,000 + minor * 1,000 + release, as "major.minor.release".
+func formatVersion(version uint32) string {
+	return fmt.Sprintf("%d.%d.%d", version/1000000, version/1000%1000, version%1000)
+}
+
+// CollectHostNode reports the versions, CPU topology and memory of the
+// host, so that the capacity of compute hosts can be derived from the
+// same source as the usage of their domains.
+func (e *LibvirtExporter) CollectHostNode(ch chan<- prometheus.Metric, conn *libvirt.Connect) error {
+	hypervisorVersion, err := conn.GetVersion()
+	if err != nil {
+		e.countError("virConnectGetVersion", err)
+		return err
+	}
+	libVersion, err := conn.GetLibVersion()
+	if err != nil {
+		e.countError("virConnectGetLibVersion", err)
+		return err
+	}
+	ch <- infoMetric(
+		e.libvirtHostVersionInfoDesc,
+		formatVersion(hypervisorVersion),
+		formatVersion(libVersion))
+
+	info, err := conn.GetNodeInfo()
+	if err != nil {
+		e.countError("virNodeGetInfo", err)
+		return err
+	}
+	for _, m := range []struct {
+		desc  *prometheus.Desc
+		value float64
+	}{
+		// Memory is reported by libvirt in KiB.
+		{e.libvirtHostMemoryDesc, float64(info.Memory) * 1024},
+		{e.libvirtHostCpuFrequencyDesc, float64(info.MHz) * 1e6},
+		{e.libvirtHostNumaNodesDesc, float64(info.Nodes)},
+		{e.libvirtHostCpuSocketsDesc, float64(info.Sockets)},
+		{e.libvirtHostCpuCoresDesc, float64(info.Cores)},
+		{e.libvirtHostCpuThreadsDesc, float64(info.Threads)},
+	} {
+		ch <- prometheus.MustNewConstMetric(m.desc, prometheus.GaugeValue, m.value)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostCpusDesc,
+		prometheus.GaugeValue,
+		float64(info.Cpus),
+		info.Model)
+
+	memoryStats, err := conn.GetMemoryStats(libvirt.NODE_MEMORY_STATS_ALL_CELLS, 0)
+	if err != nil {
+		e.countError("virNodeGetMemoryStats", err)
+		return err
+	}
+	if memoryStats.TotalSet {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtHostMemoryStatsTotalDesc,
+			prometheus.GaugeValue,
+			float64(memoryStats.Total)*1024)
+	}
+	if memoryStats.FreeSet {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtHostMemoryStatsFreeDesc,
+			prometheus.GaugeValue,
+			float64(memoryStats.Free)*1024)
+	}
+	if memoryStats.BuffersSet {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtHostMemoryStatsBuffDesc,
+			prometheus.GaugeValue,
+			float64(memoryStats.Buffers)*1024)
+	}
+	if memoryStats.CachedSet {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtHostMemoryStatsCacheDesc,
+			prometheus.GaugeValue,
+			float64(memoryStats.Cached)*1024)
+	}
+	if memoryStats.FreeSet {
+		return e.CollectHostMemoryHeadroom(ch, conn, memoryStats.Free)
+	}
+	return nil
+}
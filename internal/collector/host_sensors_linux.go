@@ -0,0 +1,167 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// cpuSysfsDir holds the frequency scaling and thermal throttling
+	// state of every CPU of the host.
+	cpuSysfsDir = "/sys/devices/system/cpu"
+	// hwmonSysfsDir holds the hardware sensors of the host.
+	hwmonSysfsDir = "/sys/class/hwmon"
+)
+
+// readSysfsUint reads a file of sysfs holding a single integer.
+func readSysfsUint(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// isCPUTemperatureSensor returns whether a temperature sensor of a hwmon
+// chip measures a whole CPU package, rather than e.g. a single core or a
+// disk. The sensors of AMD chips all measure the package or its dies.
+func isCPUTemperatureSensor(chip, label string) bool {
+	switch chip {
+	case "coretemp":
+		return strings.HasPrefix(label, "Package id")
+	case "k10temp", "zenpower":
+		return true
+	}
+	return false
+}
+
+// CollectHostSensors reports the frequency of every CPU of the host, the
+// number of times CPU packages were throttled because they overheated,
+// and their temperature, which explain domains slowing down without being
+// any busier. libvirt does not report them, so they are read from sysfs,
+// and are only available when the exporter runs on the host it scrapes.
+func (e *LibvirtExporter) CollectHostSensors(ch chan<- prometheus.Metric) error {
+	cpuDirs, err := filepath.Glob(filepath.Join(cpuSysfsDir, "cpu[0-9]*"))
+	if err != nil {
+		return err
+	}
+	packages := map[string]bool{}
+	for _, dir := range cpuDirs {
+		cpu := strings.TrimPrefix(filepath.Base(dir), "cpu")
+		// CPUs without frequency scaling, e.g. in virtual machines, or
+		// that are offline have no cpufreq directory.
+		if freq, err := readSysfsUint(filepath.Join(dir, "cpufreq", "scaling_cur_freq")); err == nil {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtHostCpuScalingFrequencyDesc,
+				prometheus.GaugeValue,
+				float64(freq)*1e3,
+				cpu)
+		}
+		if freq, err := readSysfsUint(filepath.Join(dir, "cpufreq", "scaling_max_freq")); err == nil {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtHostCpuScalingMaxFrequencyDesc,
+				prometheus.GaugeValue,
+				float64(freq)*1e3,
+				cpu)
+		}
+
+		// Throttling is counted per package, and reported by all of
+		// its CPUs.
+		pkg, err := readSysfsUint(filepath.Join(dir, "topology", "physical_package_id"))
+		if err != nil {
+			continue
+		}
+		pkgID := strconv.FormatUint(pkg, 10)
+		if packages[pkgID] {
+			continue
+		}
+		if count, err := readSysfsUint(filepath.Join(dir, "thermal_throttle", "package_throttle_count")); err == nil {
+			packages[pkgID] = true
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtHostCpuPackageThrottlesDesc,
+				prometheus.CounterValue,
+				float64(count),
+				pkgID)
+		}
+	}
+
+	return e.collectCPUTemperatures(ch, hwmonSysfsDir)
+}
+
+// hwmonDevice returns the name of the device a hwmon chip monitors, such
+// as the PCI address of the northbridge of an AMD CPU, which tells apart
+// the chips of the same driver on multi-socket hosts, or the name of the
+// directory of the chip if it has no device.
+func hwmonDevice(dir string) string {
+	if device, err := os.Readlink(filepath.Join(dir, "device")); err == nil {
+		return filepath.Base(device)
+	}
+	return filepath.Base(dir)
+}
+
+// collectCPUTemperatures reports the temperature of the CPU packages of
+// the host, from the hwmon chips in the given directory.
+func (e *LibvirtExporter) collectCPUTemperatures(ch chan<- prometheus.Metric, hwmonDir string) error {
+	chipDirs, err := filepath.Glob(filepath.Join(hwmonDir, "hwmon*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range chipDirs {
+		name, err := ioutil.ReadFile(filepath.Join(dir, "name"))
+		if err != nil {
+			continue
+		}
+		chip := strings.TrimSpace(string(name))
+		device := hwmonDevice(dir)
+		inputs, err := filepath.Glob(filepath.Join(dir, "temp[0-9]*_input"))
+		if err != nil {
+			continue
+		}
+		for _, input := range inputs {
+			sensor := strings.TrimSuffix(filepath.Base(input), "_input")
+			if label, err := ioutil.ReadFile(filepath.Join(dir, sensor+"_label")); err == nil {
+				sensor = strings.TrimSpace(string(label))
+			}
+			if !isCPUTemperatureSensor(chip, sensor) {
+				continue
+			}
+			// Temperatures are reported in millidegrees Celsius,
+			// and may be negative.
+			data, err := ioutil.ReadFile(input)
+			if err != nil {
+				continue
+			}
+			temperature, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtHostCpuTemperatureDesc,
+				prometheus.GaugeValue,
+				float64(temperature)/1e3,
+				chip, device, sensor)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// writeHwmonChip creates a hwmon chip monitoring the given device in a
+// fake sysfs tree, with temperature sensors given as label=millidegrees.
+func writeHwmonChip(t *testing.T, root, hwmon, name, device string, sensors ...string) {
+	t.Helper()
+	deviceDir := filepath.Join(root, "devices", device)
+	chipDir := filepath.Join(root, "class", "hwmon", hwmon)
+	for _, dir := range []string{deviceDir, chipDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(deviceDir, filepath.Join(chipDir, "device")); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"name": name + "\n"}
+	for i, sensor := range sensors {
+		label := strings.SplitN(sensor, "=", 2)
+		prefix := "temp" + string(rune('1'+i))
+		files[prefix+"_label"] = label[0] + "\n"
+		files[prefix+"_input"] = label[1] + "\n"
+	}
+	for file, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(chipDir, file), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCPUTemperatures(t *testing.T) {
+	root := t.TempDir()
+	// A dual-socket AMD host has a k10temp chip per socket, both
+	// reporting the same sensors.
+	writeHwmonChip(t, root, "hwmon0", "k10temp", "0000:00:18.3", "Tctl=45500", "Tccd1=41250")
+	writeHwmonChip(t, root, "hwmon1", "k10temp", "0000:80:18.3", "Tctl=52000", "Tccd1=48000")
+	writeHwmonChip(t, root, "hwmon2", "nvme", "nvme0", "Composite=38850")
+
+	e := newTestExporter(t, testURI)
+	ch := make(chan prometheus.Metric, 16)
+	if err := e.collectCPUTemperatures(ch, filepath.Join(root, "class", "hwmon")); err != nil {
+		t.Fatalf("Failed to collect temperatures: %s", err)
+	}
+	close(ch)
+
+	got := map[string]float64{}
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatalf("Failed to write metric: %s", err)
+		}
+		labels := map[string]string{}
+		for _, pair := range m.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		key := labels["chip"] + "/" + labels["device"] + "/" + labels["sensor"]
+		if _, ok := got[key]; ok {
+			t.Errorf("Duplicate series for %s", key)
+		}
+		got[key] = m.GetGauge().GetValue()
+	}
+	want := map[string]float64{
+		"k10temp/0000:00:18.3/Tctl":  45.5,
+		"k10temp/0000:00:18.3/Tccd1": 41.25,
+		"k10temp/0000:80:18.3/Tctl":  52,
+		"k10temp/0000:80:18.3/Tccd1": 48,
+	}
+	if len(got) != len(want) {
+		t.Errorf("Got temperatures %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("Temperature of %s is %g, want %g", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package collector
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Status flags and states of adjtimex(2), from <sys/timex.h>.
+	timexStatusUnsync = 0x0040 // STA_UNSYNC
+	timexStatusNano   = 0x2000 // STA_NANO
+	timexStateError   = 5      // TIME_ERROR
+)
+
+// CollectHostTime reports the time of the host and the state of its clock
+// synchronization, as maintained by the kernel on behalf of NTP daemons.
+func (e *LibvirtExporter) CollectHostTime(ch chan<- prometheus.Metric) error {
+	// A zero Modes field makes adjtimex(2) read-only.
+	var timex syscall.Timex
+	state, err := syscall.Adjtimex(&timex)
+	if err != nil {
+		return err
+	}
+
+	synced := 0.0
+	if timex.Status&timexStatusUnsync == 0 && state != timexStateError {
+		synced = 1.0
+	}
+	// The offset is expressed in nanoseconds when STA_NANO is set, in
+	// microseconds otherwise. Error estimates are always in microseconds.
+	offsetDivisor := 1e6
+	if timex.Status&timexStatusNano != 0 {
+		offsetDivisor = 1e9
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostTimeDesc,
+		prometheus.GaugeValue,
+		float64(time.Now().UnixNano())/1e9)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostTimeSyncStatusDesc,
+		prometheus.GaugeValue,
+		synced)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostTimeOffsetDesc,
+		prometheus.GaugeValue,
+		float64(timex.Offset)/offsetDivisor)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostTimeMaxErrorDesc,
+		prometheus.GaugeValue,
+		float64(timex.Maxerror)/1e6)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostTimeEstimatedErrorDesc,
+		prometheus.GaugeValue,
+		float64(timex.Esterror)/1e6)
+	return nil
+}
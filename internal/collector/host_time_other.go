@@ -0,0 +1,27 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CollectHostTime does nothing, as the state of clock synchronization can
+// only be obtained on Linux.
+func (e *LibvirtExporter) CollectHostTime(ch chan<- prometheus.Metric) error {
+	return nil
+}
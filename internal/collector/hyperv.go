@@ -0,0 +1,65 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainHyperV reports the Hyper-V enlightenments configured for a
+// domain in the <hyperv> element of its features, as Windows guests
+// missing enlightenments such as relaxed, vapic or stimer perform poorly.
+// Nothing is reported for domains without Hyper-V enlightenments.
+func (e *LibvirtExporter) CollectDomainHyperV(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	hyperv := desc.Features.HyperV
+	if hyperv == nil {
+		return
+	}
+	// The mode defaults to custom, in which the enlightenments are
+	// listed explicitly.
+	mode := hyperv.Mode
+	if mode == "" {
+		mode = "custom"
+	}
+	ch <- infoMetric(
+		e.libvirtDomainHyperVInfoDesc,
+		append(domainLabelValues, mode)...)
+
+	for _, enlightenment := range hyperv.Enlightenments {
+		name := enlightenment.XMLName.Local
+		ch <- infoMetric(
+			e.libvirtDomainHyperVEnlightenmentDesc,
+			append(domainLabelValues, name, enlightenment.State)...)
+		// Direct synthetic timers are reported as an enlightenment of
+		// their own, as they are enabled separately.
+		if enlightenment.Direct != nil {
+			ch <- infoMetric(
+				e.libvirtDomainHyperVEnlightenmentDesc,
+				append(domainLabelValues, name+"_direct", enlightenment.Direct.State)...)
+		}
+		if name == "spinlocks" && enlightenment.State == "on" {
+			if retries, err := strconv.ParseUint(enlightenment.Retries, 10, 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(
+					e.libvirtDomainHyperVSpinlockRetriesDesc,
+					prometheus.GaugeValue,
+					float64(retries),
+					domainLabelValues...)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// infoDescs records the label names of the info metrics of an exporter,
+// by metric name. Info metrics expose metadata as labels of a gauge whose
+// value is always 1, following the OpenMetrics convention, so that they
+// can be joined with other metrics. Their label sets are part of the
+// interface of the exporter: renaming or removing a label breaks the
+// queries relying on it.
+type infoDescs map[string][]string
+
+// newDesc creates the description of an info metric and records its
+// labels. It panics if the name lacks the _info suffix, as that is a
+// programming error.
+func (d infoDescs) newDesc(fqName, help string, labels []string) *prometheus.Desc {
+	if !strings.HasSuffix(fqName, "_info") {
+		panic(fmt.Sprintf("info metric %s lacks the _info suffix", fqName))
+	}
+	d[fqName] = labels
+	return prometheus.NewDesc(fqName, help+" The value is always 1.", labels, nil)
+}
+
+// infoMetric returns a sample of an info metric.
+func infoMetric(desc *prometheus.Desc, labelValues ...string) prometheus.Metric {
+	return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, labelValues...)
+}
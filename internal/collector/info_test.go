@@ -0,0 +1,153 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// wantInfoLabels lists the labels of every info metric, with the default
+// domain labels. Adding a label is harmless, but renaming, reordering or
+// removing one breaks the queries of users, so this table must only be
+// changed on purpose, with a note in the README.
+var wantInfoLabels = map[string][]string{
+	"libvirt_exporter_config_info":             {"collectors", "collector_intervals", "domain_filter", "domain_uuid_file", "include_inactive", "block_source_label", "max_concurrent_collects", "hash"},
+	"libvirt_host_hardware_info":               {"vendor", "product", "serial", "bios_version"},
+	"libvirt_host_version_info":                {"hypervisor_version", "libvirt_version"},
+	"libvirt_domain_info":                      {"domain", "resource_id", "hypervisor_type", "os_type", "arch", "machine"},
+	"libvirt_domain_openstack_info":            {"domain", "resource_id", "instance_name", "flavor", "project_id", "project_name", "user_id", "user_name"},
+	"libvirt_domain_job_info":                  {"domain", "resource_id", "type", "operation"},
+	"libvirt_domain_clock_info":                {"domain", "resource_id", "offset", "basis", "timezone"},
+	"libvirt_domain_clock_timer_info":          {"domain", "resource_id", "timer", "present", "tickpolicy", "track", "mode", "frequency"},
+	"libvirt_domain_hyperv_info":               {"domain", "resource_id", "mode"},
+	"libvirt_domain_hyperv_enlightenment_info": {"domain", "resource_id", "enlightenment", "state"},
+	"libvirt_domain_platform_feature_info":     {"domain", "resource_id", "feature", "setting"},
+	"libvirt_domain_graphics_info":             {"domain", "resource_id", "type", "port", "tls_port", "listen", "autoport"},
+	"libvirt_domain_block_info":                {"domain", "resource_id", "source_file", "target_device", "source", "disk_type", "driver_type"},
+	"libvirt_domain_block_host_device_info":    {"domain", "resource_id", "source_file", "target_device", "host_device"},
+	"libvirt_domain_block_guest_device_info":   {"domain", "resource_id", "source_file", "target_device", "serial", "guest_device"},
+}
+
+// infoDomain is a domain description for which all info metrics derived
+// from the XML are emitted.
+const infoDomain = `<domain type='kvm'>
+  <name>instance-00000001</name>
+  <uuid>6695eb01-f6a4-8304-79aa-97f2502e193f</uuid>
+  <metadata>
+    <nova:instance xmlns:nova="http://openstack.org/xmlns/libvirt/nova/1.0">
+      <nova:name>vm</nova:name>
+      <nova:flavor name="m1.small"/>
+      <nova:owner>
+        <nova:user uuid="user">alice</nova:user>
+        <nova:project uuid="project">demo</nova:project>
+      </nova:owner>
+    </nova:instance>
+  </metadata>
+  <vcpu>2</vcpu>
+  <os><type arch='x86_64' machine='pc'>hvm</type></os>
+  <features><hyperv mode='custom'><relaxed state='on'/><spinlocks state='on' retries='8191'/></hyperv><gic version='3'/></features>
+  <clock offset='utc'><timer name='rtc' tickpolicy='catchup'/></clock>
+  <devices>
+    <disk type='file' device='disk'><driver name='qemu' type='qcow2'/><source file='/var/lib/disk'/><target dev='vda' bus='virtio'/></disk>
+    <graphics type='vnc' port='5900' autoport='no'><listen type='address' address='127.0.0.1'/></graphics>
+  </devices>
+</domain>`
+
+func TestInfoLabels(t *testing.T) {
+	e := newTestExporter(t, testURI)
+	for name, want := range wantInfoLabels {
+		got, ok := e.infoLabels[name]
+		if !ok {
+			t.Errorf("Info metric %s is no longer exported", name)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Info metric %s has labels %v, want %v", name, got, want)
+		}
+	}
+	for name := range e.infoLabels {
+		if _, ok := wantInfoLabels[name]; !ok {
+			t.Errorf("Info metric %s is missing from wantInfoLabels", name)
+		}
+	}
+}
+
+// checkInfoFamilies checks that the samples of the info metrics among the
+// given families are gauges with a value of 1, and carry the labels
+// recorded for them.
+func checkInfoFamilies(t *testing.T, e *LibvirtExporter, families []*dto.MetricFamily) {
+	t.Helper()
+	for _, family := range families {
+		name := family.GetName()
+		if !strings.HasSuffix(name, "_info") {
+			continue
+		}
+		labels, ok := e.infoLabels[name]
+		if !ok {
+			t.Errorf("Info metric %s was not created with infoDescs.newDesc", name)
+			continue
+		}
+		if family.GetType() != dto.MetricType_GAUGE {
+			t.Errorf("Info metric %s has type %s, want GAUGE", name, family.GetType())
+			continue
+		}
+		want := append([]string(nil), labels...)
+		sort.Strings(want)
+		for _, m := range family.GetMetric() {
+			if value := m.GetGauge().GetValue(); value != 1 {
+				t.Errorf("Info metric %s has value %g, want 1", name, value)
+			}
+			var got []string
+			for _, pair := range m.GetLabel() {
+				got = append(got, pair.GetName())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Info metric %s has labels %v, want %v", name, got, want)
+			}
+		}
+	}
+}
+
+func TestInfoMetrics(t *testing.T) {
+	e := newTestExporter(t, testURI)
+
+	var families []*dto.MetricFamily
+	for _, family := range gather(t, e) {
+		families = append(families, family)
+	}
+	checkInfoFamilies(t, e, families)
+
+	var desc libvirt_schema.Domain
+	if err := xml.Unmarshal([]byte(infoDomain), &desc); err != nil {
+		t.Fatalf("Failed to parse domain: %s", err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(&previewCollector{exporter: e, desc: &desc}); err != nil {
+		t.Fatalf("Failed to register preview collector: %s", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %s", err)
+	}
+	checkInfoFamilies(t, e, families)
+}
@@ -0,0 +1,467 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// testURI is the URI of libvirt's built-in test driver, which provides a
+// running domain named "test" and a storage pool named "default-pool"
+// without requiring a hypervisor.
+const testURI = "test:///default"
+
+// newTestExporter creates an exporter for the given URI, with all
+// collectors enabled, and no optional exports besides storage volumes.
+func newTestExporter(tb testing.TB, uri string) *LibvirtExporter {
+	tb.Helper()
+	return newTestExporterWith(tb, LibvirtExporterOptions{
+		URI:           uri,
+		ExportVolumes: true,
+	})
+}
+
+// newFullTestExporter creates an exporter for the given URI, with all
+// collectors and optional exports enabled, except for those that require
+// files of the host or the event loop.
+func newFullTestExporter(tb testing.TB, uri string) *LibvirtExporter {
+	tb.Helper()
+	return newTestExporterWith(tb, LibvirtExporterOptions{
+		URI:                 uri,
+		ExportNovaMetadata:  true,
+		ExportNanoseconds:   true,
+		ExportVolumes:       true,
+		ExportNWFilters:     true,
+		ExportBlockIoTune:   true,
+		CgroupFallback:      true,
+		ResolveHostDevices:  true,
+		BackupNamespace:     "http://example.com/backup",
+		ExportCheckpoints:   true,
+		ExportPendingReboot: true,
+		ExportGuestDisks:    true,
+	})
+}
+
+// newTestExporterWith creates an exporter with the given options,
+// completed with the settings shared by all tests.
+func newTestExporterWith(tb testing.TB, opts LibvirtExporterOptions) *LibvirtExporter {
+	tb.Helper()
+	pool := NewConnPool(1)
+	tb.Cleanup(pool.Close)
+	opts.BlockSourceLabel = "file"
+	opts.Logger = NewThrottledLogger(time.Minute)
+	opts.Pool = pool
+	opts.MaxConcurrentCollects = 1
+	e, err := NewLibvirtExporter(opts)
+	if err != nil {
+		tb.Fatalf("Failed to create exporter: %s", err)
+	}
+	return e
+}
+
+// gather collects the metrics of an exporter through a pedantic registry,
+// which fails if a metric is inconsistent with the descriptions returned
+// by Describe or with the other metrics of its family.
+func gather(tb testing.TB, e *LibvirtExporter) map[string]*dto.MetricFamily {
+	tb.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(e); err != nil {
+		tb.Fatalf("Failed to register exporter: %s", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		tb.Fatalf("Failed to gather metrics: %s", err)
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// findMetric returns the metric of a family whose labels include the
+// given ones, or nil if there is none.
+func findMetric(family *dto.MetricFamily, labels map[string]string) *dto.Metric {
+	if family == nil {
+		return nil
+	}
+	for _, m := range family.GetMetric() {
+		matched := 0
+		for _, pair := range m.GetLabel() {
+			if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return m
+		}
+	}
+	return nil
+}
+
+// metricValue returns the value of a gauge, counter or untyped metric.
+func metricValue(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	default:
+		return m.Untyped.GetValue()
+	}
+}
+
+func TestIntegrationTestDriver(t *testing.T) {
+	families := gather(t, newTestExporter(t, testURI))
+
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"libvirt_up", nil, 1},
+		{"libvirt_exporter_scrapes_total", nil, 1},
+		{"libvirt_host_maintenance", nil, 0},
+		{"libvirt_domain_info_virtual_cpus", map[string]string{"domain": "test"}, 2},
+		{"libvirt_domain_info_maximum_memory_bytes", map[string]string{"domain": "test"}, 8 << 30},
+		{"libvirt_scrape_domains", nil, 1},
+	} {
+		m := findMetric(families[tc.name], tc.labels)
+		if m == nil {
+			t.Errorf("Metric %s%v not found", tc.name, tc.labels)
+			continue
+		}
+		if value := metricValue(m); value != tc.value {
+			t.Errorf("Metric %s%v has value %g, want %g", tc.name, tc.labels, value, tc.value)
+		}
+	}
+
+	// Every collector must have run, whether or not its metrics are
+	// supported by the test driver.
+	for _, name := range CollectorNames {
+		labels := map[string]string{"collector": name}
+		if findMetric(families["libvirt_scrape_duration_seconds"], labels) == nil {
+			t.Errorf("Duration of collector %s not reported", name)
+		}
+	}
+
+	// Domain metrics must carry the domain labels.
+	m := findMetric(families["libvirt_domain_info_virtual_cpus"], map[string]string{"domain": "test"})
+	if m != nil {
+		labels := map[string]bool{}
+		for _, pair := range m.GetLabel() {
+			labels[pair.GetName()] = true
+		}
+		for _, name := range []string{"domain", "resource_id"} {
+			if !labels[name] {
+				t.Errorf("Label %s missing from libvirt_domain_info_virtual_cpus", name)
+			}
+		}
+	}
+}
+
+// goldenFamily describes a metric family exported for the test driver.
+type goldenFamily struct {
+	// required is whether the test driver always provides metrics of
+	// the family, rather than depending on the host running the tests,
+	// on the version of libvirt or on errors.
+	required bool
+	labels   []string
+}
+
+// goldenFamilies lists every metric family that may be exported for the
+// test driver by newFullTestExporter, with the names of its labels.
+// Adding, renaming or relabelling a family must be reflected here, as it
+// affects the queries of users.
+var goldenFamilies = map[string]goldenFamily{
+	"libvirt_domain_blkio_cgroup_weight":                        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_blkio_weight":                               {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_blkio_weight_mismatch":                      {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_block_allocation_bytes":                     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_capacity_bytes":                       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_encrypted":                            {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "format"}},
+	"libvirt_domain_block_guest_device_info":                    {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "serial", "guest_device"}},
+	"libvirt_domain_block_host_device_info":                     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "host_device"}},
+	"libvirt_domain_block_info":                                 {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "source", "disk_type", "driver_type"}},
+	"libvirt_domain_block_iotune_burst_bytes_per_second":        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "direction"}},
+	"libvirt_domain_block_iotune_burst_iops":                    {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "direction"}},
+	"libvirt_domain_block_iotune_bytes_per_second":              {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "direction"}},
+	"libvirt_domain_block_iotune_iops":                          {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device", "direction"}},
+	"libvirt_domain_block_multipath_active_paths":               {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_multipath_paths":                      {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_physicalsize_bytes":                   {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_flush_nanoseconds_total":        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_flush_requests_total":           {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_flush_seconds_total":            {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_read_bytes_total":               {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_read_nanoseconds_total":         {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_read_requests_total":            {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_read_seconds_total":             {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_write_bytes_total":              {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_write_nanoseconds_total":        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_write_requests_total":           {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_block_stats_write_seconds_total":            {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_file", "target_device"}},
+	"libvirt_domain_cachetune_size_bytes":                       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "vcpus", "cache", "level", "type"}},
+	"libvirt_domain_cgroup_fallbacks_total":                     {false, []string{"stats"}},
+	"libvirt_domain_cgroup_io_read_bytes_total":                 {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_cgroup_io_read_requests_total":              {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_cgroup_io_write_bytes_total":                {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_cgroup_io_write_requests_total":             {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_channel_connected":                          {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "channel"}},
+	"libvirt_domain_clock_adjustment_seconds":                   {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_clock_info":                                 {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "offset", "basis", "timezone"}},
+	"libvirt_domain_clock_timer_info":                           {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "timer", "present", "tickpolicy", "track", "mode", "frequency"}},
+	"libvirt_domain_config_changed_timestamp_seconds":           {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_config_changes_total":                       {false, []string{"event", "detail"}},
+	"libvirt_domain_cpu_cores_per_die":                          {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_cpu_dies_per_socket":                        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_cpu_sockets":                                {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_cpu_threads_per_core":                       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_devices":                                    {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "kind", "model", "class"}},
+	"libvirt_domain_graphics_info":                              {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "type", "port", "tls_port", "listen", "autoport"}},
+	"libvirt_domain_hyperv_enlightenment_info":                  {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "enlightenment", "state"}},
+	"libvirt_domain_hyperv_info":                                {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "mode"}},
+	"libvirt_domain_hyperv_spinlock_retries":                    {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_info":                                       {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "hypervisor_type", "os_type", "arch", "machine"}},
+	"libvirt_domain_info_cpu_time_nanoseconds_total":            {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_info_cpu_time_seconds_total":                {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_info_id":                                    {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_info_maximum_memory_bytes":                  {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_info_memory_usage_bytes":                    {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_info_virtual_cpus":                          {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_interface_bridge_mtu_bytes":                 {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_mtu_bytes":                        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_mtu_mismatch":                     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_nwfilter_rules":                   {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device", "filter"}},
+	"libvirt_domain_interface_queue_length":                     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_queues":                           {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_receive_bytes_total":        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_receive_drops_total":        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_receive_errors_total":       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_receive_packets_total":      {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_receive_queue_drops_total":  {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_transmit_bytes_total":       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_transmit_drops_total":       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_transmit_errors_total":      {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_transmit_packets_total":     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_stats_transmit_queue_drops_total": {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_interface_tap_mtu_bytes":                    {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "source_bridge", "target_device"}},
+	"libvirt_domain_job_data_processed_bytes":                   {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_job_data_remaining_bytes":                   {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_job_data_total_bytes":                       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_job_downtime_seconds":                       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_job_elapsed_seconds":                        {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_job_info":                                   {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "type", "operation"}},
+	"libvirt_domain_job_memory_dirty_rate_bytes_per_second":     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_job_memory_iteration":                       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_job_remaining_seconds":                      {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_last_backup_timestamp_seconds":              {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_actual_balloon_bytes":          {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_available_bytes":               {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_disk_caches_bytes":             {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_major_faults_total":            {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_minor_faults_total":            {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_rss_bytes":                     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_swap_in_bytes_total":           {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_swap_out_bytes_total":          {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_unused_bytes":                  {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memory_stats_usable_bytes":                  {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_memorytune_bandwidth":                       {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "vcpus", "node"}},
+	"libvirt_domain_nested_virtualization":                      {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "cpu_mode"}},
+	"libvirt_domain_openstack_info":                             {false, []string{"domain", "resource_id", "instance_name", "flavor", "project_id", "project_name", "user_id", "user_name"}},
+	"libvirt_domain_pending_reboot":                             {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "change"}},
+	"libvirt_domain_platform_feature_info":                      {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "feature", "setting"}},
+	"libvirt_domain_scrape_errors_total":                        {false, []string{"domain"}},
+	"libvirt_domain_security_denials_total":                     {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "model"}},
+	"libvirt_domain_shmem_size_bytes":                           {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "shmem", "model"}},
+	"libvirt_domain_state":                                      {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "state"}},
+	"libvirt_domain_tpm_emulator_up":                            {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "model", "version"}},
+	"libvirt_domain_vcpu_time_nanoseconds_total":                {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "vcpu"}},
+	"libvirt_domain_vcpu_time_seconds_total":                    {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "vcpu"}},
+	"libvirt_domain_xml_parse_failed":                           {true, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}},
+	"libvirt_domain_xml_unknown_fields":                         {false, []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id", "field"}},
+	"libvirt_errors_total":                                      {false, []string{"code", "proc"}},
+	"libvirt_exporter_circuit_open":                             {true, []string{}},
+	"libvirt_exporter_config_info":                              {true, []string{"collectors", "collector_intervals", "domain_filter", "domain_uuid_file", "include_inactive", "block_source_label", "max_concurrent_collects", "hash"}},
+	"libvirt_exporter_interned_label_values":                    {true, []string{}},
+	"libvirt_exporter_last_scrape_timestamp_seconds":            {true, []string{}},
+	"libvirt_exporter_panics_recovered_total":                   {false, []string{"collector"}},
+	"libvirt_collector_duration_seconds":                        {true, []string{"collector"}},
+	"libvirt_exporter_scrapes_total":                            {true, []string{}},
+	"libvirt_host_cpu_cores_per_socket":                         {false, []string{}},
+	"libvirt_host_cpu_frequency_hertz":                          {false, []string{}},
+	"libvirt_host_cpu_package_throttles_total":                  {false, []string{"package"}},
+	"libvirt_host_cpu_scaling_frequency_hertz":                  {false, []string{"cpu"}},
+	"libvirt_host_cpu_scaling_frequency_max_hertz":              {false, []string{"cpu"}},
+	"libvirt_host_cpu_sockets_per_node":                         {false, []string{}},
+	"libvirt_host_cpu_temperature_celsius":                      {false, []string{"chip", "device", "sensor"}},
+	"libvirt_host_cpu_threads_per_core":                         {false, []string{}},
+	"libvirt_host_cpus":                                         {false, []string{"model"}},
+	"libvirt_host_domains":                                      {true, []string{"state", "persistence"}},
+	"libvirt_host_domains_memory_balloon_bytes":                 {false, []string{}},
+	"libvirt_host_domains_memory_maximum_bytes":                 {false, []string{}},
+	"libvirt_host_graphics_port_conflicts":                      {false, []string{}},
+	"libvirt_host_graphics_ports":                               {false, []string{}},
+	"libvirt_host_graphics_unallocated_ports":                   {false, []string{}},
+	"libvirt_host_hardware_info":                                {false, []string{"vendor", "product", "serial", "bios_version"}},
+	"libvirt_host_maintenance":                                  {true, []string{}},
+	"libvirt_host_memory_bytes":                                 {false, []string{}},
+	"libvirt_host_memory_headroom_bytes":                        {false, []string{}},
+	"libvirt_host_memory_stats_buffers_bytes":                   {false, []string{}},
+	"libvirt_host_memory_stats_cached_bytes":                    {false, []string{}},
+	"libvirt_host_memory_stats_free_bytes":                      {false, []string{}},
+	"libvirt_host_memory_stats_total_bytes":                     {false, []string{}},
+	"libvirt_host_nested_virtualization":                        {false, []string{"module"}},
+	"libvirt_host_numa_nodes":                                   {false, []string{}},
+	"libvirt_host_time_estimated_error_seconds":                 {false, []string{}},
+	"libvirt_host_time_maximum_error_seconds":                   {false, []string{}},
+	"libvirt_host_time_offset_seconds":                          {false, []string{}},
+	"libvirt_host_time_seconds":                                 {false, []string{}},
+	"libvirt_host_time_sync_status":                             {false, []string{}},
+	"libvirt_host_version_info":                                 {false, []string{"hypervisor_version", "libvirt_version"}},
+	"libvirt_scrape_domains":                                    {true, []string{}},
+	"libvirt_scrape_duration_seconds":                           {true, []string{"collector"}},
+	"libvirt_scrape_skipped_domains":                            {true, []string{"reason"}},
+	"libvirt_storage_pool_allocation_bytes":                     {false, []string{"pool", "type"}},
+	"libvirt_storage_pool_available_bytes":                      {false, []string{"pool", "type"}},
+	"libvirt_storage_pool_capacity_bytes":                       {false, []string{"pool", "type"}},
+	"libvirt_storage_pool_state":                                {true, []string{"pool", "type", "state"}},
+	"libvirt_storage_volume_allocation_bytes":                   {false, []string{"pool", "volume", "type"}},
+	"libvirt_storage_volume_capacity_bytes":                     {false, []string{"pool", "volume", "type"}},
+	"libvirt_up":                                                {true, []string{}},
+}
+
+func TestIntegrationGolden(t *testing.T) {
+	families := gather(t, newFullTestExporter(t, testURI))
+
+	for name, family := range families {
+		golden, ok := goldenFamilies[name]
+		if !ok {
+			t.Errorf("Metric family %s is missing from goldenFamilies", name)
+			continue
+		}
+		want := append([]string(nil), golden.labels...)
+		sort.Strings(want)
+		for _, m := range family.GetMetric() {
+			var got []string
+			for _, pair := range m.GetLabel() {
+				got = append(got, pair.GetName())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+				t.Errorf("Metric family %s has labels %v, want %v", name, got, want)
+				break
+			}
+		}
+	}
+	for name, golden := range goldenFamilies {
+		if _, ok := families[name]; golden.required && !ok {
+			t.Errorf("Metric family %s was not exported", name)
+		}
+	}
+}
+
+// TestIntegrationDescriptions checks the descriptions of the metrics,
+// which does not require a connection: the registry rejects those with
+// duplicate label names, such as a label named like a Nova label.
+func TestIntegrationDescriptions(t *testing.T) {
+	for _, nova := range []bool{false, true} {
+		e := newTestExporterWith(t, LibvirtExporterOptions{ExportNovaMetadata: nova})
+		if err := prometheus.NewPedanticRegistry().Register(e); err != nil {
+			t.Errorf("Failed to register exporter with Nova metadata %v: %s", nova, err)
+		}
+	}
+	e := newTestExporterWith(t, LibvirtExporterOptions{
+		ExportNovaMetadata:  true,
+		DomainLabelRenames:  map[string]string{"resource_id": "uuid"},
+		DroppedDomainLabels: map[string]bool{"flavor": true},
+	})
+	if err := prometheus.NewPedanticRegistry().Register(e); err != nil {
+		t.Errorf("Failed to register exporter with mapped labels: %s", err)
+	}
+	for name, golden := range goldenFamilies {
+		seen := make(map[string]bool, len(golden.labels))
+		for _, label := range golden.labels {
+			if seen[label] {
+				t.Errorf("Metric family %s has duplicate label %s", name, label)
+			}
+			seen[label] = true
+		}
+	}
+}
+
+func TestIntegrationTracing(t *testing.T) {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	defer provider.Shutdown(context.Background())
+	e := newTestExporterWith(t, LibvirtExporterOptions{
+		URI:    testURI,
+		Tracer: provider.Tracer("test"),
+	})
+	families := gather(t, e)
+
+	m := findMetric(families["libvirt_collector_duration_seconds"], map[string]string{"collector": "domains"})
+	if m == nil {
+		t.Fatalf("Duration of the domains collector was not exported")
+	}
+	for _, bucket := range m.GetHistogram().GetBucket() {
+		for _, pair := range bucket.GetExemplar().GetLabel() {
+			if pair.GetName() == "trace_id" && len(pair.GetValue()) == 32 {
+				return
+			}
+		}
+	}
+	t.Errorf("No bucket of the duration of the domains collector has a trace ID exemplar")
+}
+
+func TestIntegrationUnscraped(t *testing.T) {
+	e := newTestExporter(t, testURI)
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(e.Unscraped()); err != nil {
+		t.Fatalf("Failed to register exporter: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := registry.Gather(); err != nil {
+			t.Fatalf("Failed to gather metrics: %s", err)
+		}
+	}
+
+	families := gather(t, e)
+	if got := metricValue(findMetric(families["libvirt_exporter_scrapes_total"], nil)); got != 1 {
+		t.Errorf("Got %v scrapes after gathering unscraped metrics twice, want 1", got)
+	}
+}
+
+func TestIntegrationUnreachable(t *testing.T) {
+	families := gather(t, newTestExporter(t, "test:///nonexistent.xml"))
+
+	m := findMetric(families["libvirt_up"], nil)
+	if m == nil {
+		t.Fatal("Metric libvirt_up not found")
+	}
+	if value := metricValue(m); value != 0 {
+		t.Errorf("Metric libvirt_up has value %g, want 0", value)
+	}
+	// Heartbeat metrics are reported even when libvirt cannot be reached.
+	if findMetric(families["libvirt_exporter_scrapes_total"], nil) == nil {
+		t.Error("Metric libvirt_exporter_scrapes_total not found")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// readNetDeviceMTU reads the MTU of a network device of the host from
+// sysfs.
+func readNetDeviceMTU(device string) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(sysClassNetDir, filepath.Base(device), "mtu"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// CollectDomainInterfaceMTU reports the MTU configured for the network
+// interfaces of a domain and, if inspectHost is set, those of the tap
+// devices and bridges backing them on the host. Interfaces whose MTU is
+// not configured inherit that of their bridge. A mismatch between these
+// MTUs, typically left behind by a change of the MTU of the host network,
+// drops or fragments large packets. Interfaces without a target device,
+// such as those of inactive domains, are skipped, as they could not be
+// told apart from each other.
+func (e *LibvirtExporter) CollectDomainInterfaceMTU(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain, inspectHost bool) {
+	for _, iface := range desc.Devices.Interfaces {
+		if iface.Target.Device == "" {
+			continue
+		}
+		interfaceLabelValues := append(domainLabelValues, iface.Source.Bridge, iface.Target.Device)
+		var mtus []uint64
+		if iface.MTU != nil && iface.MTU.Size != 0 {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceMTUDesc,
+				prometheus.GaugeValue,
+				float64(iface.MTU.Size),
+				interfaceLabelValues...)
+			mtus = append(mtus, uint64(iface.MTU.Size))
+		}
+		if !inspectHost {
+			continue
+		}
+		tapMTU, err := readNetDeviceMTU(iface.Target.Device)
+		if err != nil {
+			// Not every interface is backed by a network device of
+			// the host.
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInterfaceTapMTUDesc,
+			prometheus.GaugeValue,
+			float64(tapMTU),
+			interfaceLabelValues...)
+		mtus = append(mtus, tapMTU)
+		if iface.Source.Bridge != "" {
+			if bridgeMTU, err := readNetDeviceMTU(iface.Source.Bridge); err == nil {
+				ch <- prometheus.MustNewConstMetric(
+					e.libvirtDomainInterfaceBridgeMTUDesc,
+					prometheus.GaugeValue,
+					float64(bridgeMTU),
+					interfaceLabelValues...)
+				mtus = append(mtus, bridgeMTU)
+			}
+		}
+
+		mismatch := 0.0
+		for _, mtu := range mtus {
+			if mtu != mtus[0] {
+				mismatch = 1.0
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInterfaceMTUMismatchDesc,
+			prometheus.GaugeValue,
+			mismatch,
+			interfaceLabelValues...)
+	}
+}
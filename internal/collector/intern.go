@@ -0,0 +1,114 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// labelInterner deduplicates the values of the labels of domain metrics,
+// such as domain and device names, across scrapes. They are decoded anew
+// from the XML description of every domain on every scrape, while the
+// metrics of previous scrapes are still held, e.g. by background
+// collectors and by the summary of the last scrape. Interning makes all
+// of them share a single copy of every value.
+//
+// Values are kept for two generations, rotated on every run of the
+// domains collector, so that the values of domains that disappeared are
+// eventually released. A nil labelInterner returns values unchanged.
+type labelInterner struct {
+	mu       sync.Mutex
+	current  map[string]string
+	previous map[string]string
+}
+
+func newLabelInterner() *labelInterner {
+	return &labelInterner{current: map[string]string{}}
+}
+
+// intern returns the copy of a value held by the table, adding the value
+// if there is none.
+func (t *labelInterner) intern(value string) string {
+	if t == nil || value == "" {
+		return value
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if interned, ok := t.current[value]; ok {
+		return interned
+	}
+	if interned, ok := t.previous[value]; ok {
+		value = interned
+	}
+	t.current[value] = value
+	return value
+}
+
+// internDomain interns the fields of the description of a domain that are
+// used as label values.
+func (t *labelInterner) internDomain(desc *libvirt_schema.Domain) {
+	if t == nil {
+		return
+	}
+	desc.UUID = t.intern(desc.UUID)
+	instance := &desc.Metadata.NovaInstance
+	instance.Name = t.intern(instance.Name)
+	instance.Flavor.Name = t.intern(instance.Flavor.Name)
+	instance.Owner.User.UserId = t.intern(instance.Owner.User.UserId)
+	instance.Owner.Project.ProjectId = t.intern(instance.Owner.Project.ProjectId)
+	for i := range desc.Devices.Disks {
+		disk := &desc.Devices.Disks[i]
+		disk.Source.File = t.intern(disk.Source.File)
+		disk.Source.Dev = t.intern(disk.Source.Dev)
+		disk.Source.Volume = t.intern(disk.Source.Volume)
+		disk.Serial = t.intern(disk.Serial)
+		disk.Alias.Name = t.intern(disk.Alias.Name)
+		disk.Target.Device = t.intern(disk.Target.Device)
+	}
+	for i := range desc.Devices.Interfaces {
+		iface := &desc.Devices.Interfaces[i]
+		iface.Source.Bridge = t.intern(iface.Source.Bridge)
+		iface.Target.Device = t.intern(iface.Target.Device)
+	}
+}
+
+// rotate starts a new generation, forgetting the values that were not
+// interned since the previous call.
+func (t *labelInterner) rotate() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.previous = t.current
+	t.current = make(map[string]string, len(t.previous))
+}
+
+// size returns the number of values held by the table.
+func (t *labelInterner) size() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.current)
+	for value := range t.previous {
+		if _, ok := t.current[value]; !ok {
+			n++
+		}
+	}
+	return n
+}
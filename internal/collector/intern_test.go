@@ -0,0 +1,45 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// sameString returns whether two strings share the same backing array.
+func sameString(a, b string) bool {
+	return len(a) == len(b) && unsafe.StringData(a) == unsafe.StringData(b)
+}
+
+func TestLabelInterner(t *testing.T) {
+	t.Parallel()
+	table := newLabelInterner()
+	first := table.intern(strings.Repeat("domain", 2))
+	if second := table.intern(strings.Repeat("domain", 2)); !sameString(first, second) {
+		t.Error("Equal values were not shared")
+	}
+
+	// Values used since the previous rotation are kept.
+	table.rotate()
+	if second := table.intern(strings.Repeat("domain", 2)); !sameString(first, second) {
+		t.Error("Value was not kept across a rotation")
+	}
+	table.rotate()
+	table.rotate()
+	if size := table.size(); size != 0 {
+		t.Errorf("Table holds %d values after two unused generations, want 0", size)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// jobTypes maps the types of active jobs to the values of the type label
+// of libvirt_domain_job_info.
+var jobTypes = map[libvirt.DomainJobType]string{
+	libvirt.DOMAIN_JOB_BOUNDED:   "bounded",
+	libvirt.DOMAIN_JOB_UNBOUNDED: "unbounded",
+}
+
+// jobOperations maps the operations of jobs to the values of the operation
+// label of libvirt_domain_job_info.
+var jobOperations = map[libvirt.DomainJobOperationType]string{
+	libvirt.DOMAIN_JOB_OPERATION_START:           "start",
+	libvirt.DOMAIN_JOB_OPERATION_SAVE:            "save",
+	libvirt.DOMAIN_JOB_OPERATION_RESTORE:         "restore",
+	libvirt.DOMAIN_JOB_OPERATION_MIGRATION_IN:    "migration_in",
+	libvirt.DOMAIN_JOB_OPERATION_MIGRATION_OUT:   "migration_out",
+	libvirt.DOMAIN_JOB_OPERATION_SNAPSHOT:        "snapshot",
+	libvirt.DOMAIN_JOB_OPERATION_SNAPSHOT_REVERT: "snapshot_revert",
+	libvirt.DOMAIN_JOB_OPERATION_DUMP:            "dump",
+	libvirt.DOMAIN_JOB_OPERATION_UNKNOWN:         "unknown",
+}
+
+// CollectDomainJob reports the progress of the job running on a domain,
+// such as a live migration, if any. Times are reported by libvirt in
+// milliseconds.
+func (e *LibvirtExporter) CollectDomainJob(ch chan<- prometheus.Metric, domain *libvirt.Domain, domainName string, domainLabelValues []string) {
+	job, err := domain.GetJobStats(0)
+	if err != nil {
+		e.countError("virDomainGetJobStats", err)
+		if !isNoSupport(err) && !isNoDomain(err) {
+			e.logger.Printf("Failed to get job statistics of domain %s: %s", domainName, err)
+		}
+		return
+	}
+	jobType, ok := jobTypes[job.Type]
+	if !ok {
+		return
+	}
+	operation := ""
+	if job.OperationSet {
+		operation = jobOperations[job.Operation]
+	}
+	ch <- infoMetric(
+		e.libvirtDomainJobInfoDesc,
+		append(domainLabelValues, jobType, operation)...)
+
+	for _, stat := range []struct {
+		desc  *prometheus.Desc
+		set   bool
+		value float64
+	}{
+		{e.libvirtDomainJobElapsedDesc, job.TimeElapsedSet, float64(job.TimeElapsed) / 1e3},
+		{e.libvirtDomainJobRemainingDesc, job.TimeRemainingSet, float64(job.TimeRemaining) / 1e3},
+		{e.libvirtDomainJobDowntimeDesc, job.DowntimeSet, float64(job.Downtime) / 1e3},
+		{e.libvirtDomainJobDataTotalDesc, job.DataTotalSet, float64(job.DataTotal)},
+		{e.libvirtDomainJobDataProcessedDesc, job.DataProcessedSet, float64(job.DataProcessed)},
+		{e.libvirtDomainJobDataRemainingDesc, job.DataRemainingSet, float64(job.DataRemaining)},
+		{e.libvirtDomainJobMemoryDirtyRateDesc, job.MemDirtyRateSet && job.MemPageSizeSet, float64(job.MemDirtyRate) * float64(job.MemPageSize)},
+		{e.libvirtDomainJobMemoryIterationDesc, job.MemIterationSet, float64(job.MemIteration)},
+	} {
+		if !stat.set {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			stat.desc,
+			prometheus.GaugeValue,
+			stat.value,
+			domainLabelValues...)
+	}
+}
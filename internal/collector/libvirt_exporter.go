@@ -0,0 +1,2453 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package collector implements the collectors of the metrics of libvirt
+// hosts and of their domains.
+package collector
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// LibvirtExporter implements a Prometheus exporter for libvirt state.
+type LibvirtExporter struct {
+	uri                string
+	local              bool
+	exportNovaMetadata bool
+	exportNanoseconds  bool
+	blockSourceLabel   string
+	swtpmStateDir      string
+	exportVolumes      bool
+	exportNWFilters    bool
+	exportBlockIoTune  bool
+	domainFilter       *regexp.Regexp
+	domainUUIDs        *UUIDAllowlist
+	includeInactive    bool
+	disabled           map[string]bool
+	maxConcurrent      int
+	domainLabels       []string
+	keptDomainLabels   []int
+	logger             *ThrottledLogger
+	pool               *ConnPool
+	collectors         []*scheduledCollector
+	stop               chan struct{}
+	watchEvents        bool
+	cgroupFallback     bool
+	resolveHostDevices bool
+	securityDenials    *securityDenials
+	backupNamespace    string
+	exportCheckpoints  bool
+	pendingReboot      bool
+	exportGuestDisks   bool
+	configLabelValues  []string
+	domainEvents       *domainEvents
+	infoLabels         infoDescs
+	labelValues        *labelInterner
+	breaker            *circuitBreaker
+	hostLimiter        *HostLimiter
+
+	collectErrMu sync.Mutex
+	collectErr   error
+
+	maintenanceMu sync.Mutex
+	maintenance   bool
+
+	readyMu sync.Mutex
+	ready   bool
+
+	libvirtUpDesc             *prometheus.Desc
+	libvirtScrapeDurationDesc *prometheus.Desc
+
+	tracer                   trace.Tracer
+	libvirtCollectorDuration *prometheus.HistogramVec
+
+	libvirtScrapeDomainsDesc        *prometheus.Desc
+	libvirtScrapeSkippedDomainsDesc *prometheus.Desc
+
+	libvirtDomainConfigChangesDesc     *prometheus.Desc
+	libvirtDomainConfigChangedTimeDesc *prometheus.Desc
+
+	libvirtExporterScrapesTotal        prometheus.Counter
+	libvirtExporterLastScrapeTimestamp prometheus.Gauge
+	libvirtExporterPanicsRecovered     *prometheus.CounterVec
+	libvirtExporterInternedLabelsDesc  *prometheus.Desc
+
+	libvirtExporterCircuitOpenDesc *prometheus.Desc
+
+	libvirtHostTimeDesc               *prometheus.Desc
+	libvirtHostTimeSyncStatusDesc     *prometheus.Desc
+	libvirtHostTimeOffsetDesc         *prometheus.Desc
+	libvirtHostTimeMaxErrorDesc       *prometheus.Desc
+	libvirtHostTimeEstimatedErrorDesc *prometheus.Desc
+
+	libvirtHostHardwareInfoDesc *prometheus.Desc
+	libvirtHostMaintenanceDesc  *prometheus.Desc
+	libvirtExporterConfigDesc   *prometheus.Desc
+	libvirtHostDomainsDesc      *prometheus.Desc
+
+	libvirtHostVersionInfoDesc      *prometheus.Desc
+	libvirtHostMemoryDesc           *prometheus.Desc
+	libvirtHostCpusDesc             *prometheus.Desc
+	libvirtHostCpuFrequencyDesc     *prometheus.Desc
+	libvirtHostNumaNodesDesc        *prometheus.Desc
+	libvirtHostCpuSocketsDesc       *prometheus.Desc
+	libvirtHostCpuCoresDesc         *prometheus.Desc
+	libvirtHostCpuThreadsDesc       *prometheus.Desc
+	libvirtHostMemoryStatsTotalDesc *prometheus.Desc
+	libvirtHostMemoryStatsFreeDesc  *prometheus.Desc
+	libvirtHostMemoryStatsBuffDesc  *prometheus.Desc
+	libvirtHostMemoryStatsCacheDesc *prometheus.Desc
+
+	libvirtHostCpuScalingFrequencyDesc    *prometheus.Desc
+	libvirtHostCpuScalingMaxFrequencyDesc *prometheus.Desc
+	libvirtHostCpuPackageThrottlesDesc    *prometheus.Desc
+	libvirtHostCpuTemperatureDesc         *prometheus.Desc
+
+	libvirtHostDomainsMemoryBalloonDesc *prometheus.Desc
+	libvirtHostDomainsMemoryMaximumDesc *prometheus.Desc
+	libvirtHostMemoryHeadroomDesc       *prometheus.Desc
+
+	libvirtHostGraphicsPortsDesc         *prometheus.Desc
+	libvirtHostGraphicsPortConflictsDesc *prometheus.Desc
+	libvirtHostGraphicsUnallocatedDesc   *prometheus.Desc
+
+	libvirtStoragePoolStateDesc      *prometheus.Desc
+	libvirtStoragePoolCapacityDesc   *prometheus.Desc
+	libvirtStoragePoolAllocationDesc *prometheus.Desc
+	libvirtStoragePoolAvailableDesc  *prometheus.Desc
+	libvirtStorageVolCapacityDesc    *prometheus.Desc
+	libvirtStorageVolAllocationDesc  *prometheus.Desc
+
+	libvirtErrors *prometheus.CounterVec
+
+	libvirtDomainScrapeErrors    *prometheus.CounterVec
+	libvirtDomainCgroupFallbacks *prometheus.CounterVec
+
+	libvirtDomainXMLParseFailedDesc   *prometheus.Desc
+	libvirtDomainXMLUnknownFieldsDesc *prometheus.Desc
+
+	libvirtDomainCgroupIOReadBytesDesc  *prometheus.Desc
+	libvirtDomainCgroupIOWriteBytesDesc *prometheus.Desc
+	libvirtDomainCgroupIOReadReqsDesc   *prometheus.Desc
+	libvirtDomainCgroupIOWriteReqsDesc  *prometheus.Desc
+
+	libvirtDomainBlkioWeightDesc         *prometheus.Desc
+	libvirtDomainBlkioCgroupWeightDesc   *prometheus.Desc
+	libvirtDomainBlkioWeightMismatchDesc *prometheus.Desc
+
+	libvirtDomainSecurityDenialsDesc *prometheus.Desc
+	libvirtDomainLastBackupDesc      *prometheus.Desc
+
+	libvirtDomainInfoMaxMemDesc    *prometheus.Desc
+	libvirtDomainInfoMemoryDesc    *prometheus.Desc
+	libvirtDomainInfoNrVirtCpuDesc *prometheus.Desc
+	libvirtDomainInfoCpuTimeDesc   *prometheus.Desc
+	libvirtDomainInfoCpuTimeNsDesc *prometheus.Desc
+	libvirtDomainInfoIdDesc        *prometheus.Desc
+	libvirtDomainInfoDesc          *prometheus.Desc
+	libvirtDomainStateDesc         *prometheus.Desc
+	libvirtDomainOpenstackInfoDesc *prometheus.Desc
+
+	libvirtDomainVcpuTimeDesc   *prometheus.Desc
+	libvirtDomainVcpuTimeNsDesc *prometheus.Desc
+
+	libvirtDomainJobInfoDesc            *prometheus.Desc
+	libvirtDomainJobElapsedDesc         *prometheus.Desc
+	libvirtDomainJobRemainingDesc       *prometheus.Desc
+	libvirtDomainJobDowntimeDesc        *prometheus.Desc
+	libvirtDomainJobDataTotalDesc       *prometheus.Desc
+	libvirtDomainJobDataProcessedDesc   *prometheus.Desc
+	libvirtDomainJobDataRemainingDesc   *prometheus.Desc
+	libvirtDomainJobMemoryDirtyRateDesc *prometheus.Desc
+	libvirtDomainJobMemoryIterationDesc *prometheus.Desc
+
+	libvirtDomainTPMEmulatorUpDesc    *prometheus.Desc
+	libvirtDomainChannelConnectedDesc *prometheus.Desc
+
+	libvirtDomainClockInfoDesc       *prometheus.Desc
+	libvirtDomainClockAdjustmentDesc *prometheus.Desc
+	libvirtDomainClockTimerInfoDesc  *prometheus.Desc
+
+	libvirtDomainHyperVInfoDesc            *prometheus.Desc
+	libvirtDomainHyperVEnlightenmentDesc   *prometheus.Desc
+	libvirtDomainHyperVSpinlockRetriesDesc *prometheus.Desc
+
+	libvirtDomainPlatformFeatureDesc *prometheus.Desc
+
+	libvirtDomainNestedVirtualizationDesc *prometheus.Desc
+	libvirtHostNestedVirtualizationDesc   *prometheus.Desc
+
+	libvirtDomainPendingRebootDesc *prometheus.Desc
+
+	libvirtDomainCPUSocketsDesc *prometheus.Desc
+	libvirtDomainCPUDiesDesc    *prometheus.Desc
+	libvirtDomainCPUCoresDesc   *prometheus.Desc
+	libvirtDomainCPUThreadsDesc *prometheus.Desc
+
+	libvirtDomainDevicesDesc      *prometheus.Desc
+	libvirtDomainGraphicsInfoDesc *prometheus.Desc
+
+	libvirtDomainCacheTuneSizeDesc       *prometheus.Desc
+	libvirtDomainShmemSizeDesc           *prometheus.Desc
+	libvirtDomainMemoryTuneBandwidthDesc *prometheus.Desc
+
+	libvirtDomainMemoryStatsActualBalloonDesc *prometheus.Desc
+	libvirtDomainMemoryStatsAvailableDesc     *prometheus.Desc
+	libvirtDomainMemoryStatsUnusedDesc        *prometheus.Desc
+	libvirtDomainMemoryStatsUsableDesc        *prometheus.Desc
+	libvirtDomainMemoryStatsRssDesc           *prometheus.Desc
+	libvirtDomainMemoryStatsDiskCachesDesc    *prometheus.Desc
+	libvirtDomainMemoryStatsSwapInDesc        *prometheus.Desc
+	libvirtDomainMemoryStatsSwapOutDesc       *prometheus.Desc
+	libvirtDomainMemoryStatsMajorFaultDesc    *prometheus.Desc
+	libvirtDomainMemoryStatsMinorFaultDesc    *prometheus.Desc
+
+	libvirtDomainBlockRdBytesDesc         *prometheus.Desc
+	libvirtDomainBlockRdReqDesc           *prometheus.Desc
+	libvirtDomainBlockRdTotalTimesDesc    *prometheus.Desc
+	libvirtDomainBlockWrBytesDesc         *prometheus.Desc
+	libvirtDomainBlockWrReqDesc           *prometheus.Desc
+	libvirtDomainBlockWrTotalTimesDesc    *prometheus.Desc
+	libvirtDomainBlockFlushReqDesc        *prometheus.Desc
+	libvirtDomainBlockFlushTotalTimesDesc *prometheus.Desc
+
+	libvirtDomainBlockCapacityDesc     *prometheus.Desc
+	libvirtDomainBlockAllocationDesc   *prometheus.Desc
+	libvirtDomainBlockPhysicalSizeDesc *prometheus.Desc
+	libvirtDomainBlockEncryptedDesc    *prometheus.Desc
+	libvirtDomainBlockInfoDesc         *prometheus.Desc
+	libvirtDomainBlockHostDeviceDesc   *prometheus.Desc
+	libvirtDomainBlockGuestDeviceDesc  *prometheus.Desc
+
+	libvirtDomainBlockMultipathPathsDesc       *prometheus.Desc
+	libvirtDomainBlockMultipathActivePathsDesc *prometheus.Desc
+
+	libvirtDomainBlockIoTuneBytesDesc      *prometheus.Desc
+	libvirtDomainBlockIoTuneIopsDesc       *prometheus.Desc
+	libvirtDomainBlockIoTuneBurstBytesDesc *prometheus.Desc
+	libvirtDomainBlockIoTuneBurstIopsDesc  *prometheus.Desc
+
+	libvirtDomainBlockRdTotalTimesNsDesc    *prometheus.Desc
+	libvirtDomainBlockWrTotalTimesNsDesc    *prometheus.Desc
+	libvirtDomainBlockFlushTotalTimesNsDesc *prometheus.Desc
+
+	libvirtDomainInterfaceRxBytesDesc   *prometheus.Desc
+	libvirtDomainInterfaceRxPacketsDesc *prometheus.Desc
+	libvirtDomainInterfaceRxErrsDesc    *prometheus.Desc
+	libvirtDomainInterfaceRxDropDesc    *prometheus.Desc
+	libvirtDomainInterfaceTxBytesDesc   *prometheus.Desc
+	libvirtDomainInterfaceTxPacketsDesc *prometheus.Desc
+	libvirtDomainInterfaceTxErrsDesc    *prometheus.Desc
+	libvirtDomainInterfaceTxDropDesc    *prometheus.Desc
+
+	libvirtDomainInterfaceQueuesDesc        *prometheus.Desc
+	libvirtDomainInterfaceQueueLengthDesc   *prometheus.Desc
+	libvirtDomainInterfaceRxQueueDropsDesc  *prometheus.Desc
+	libvirtDomainInterfaceTxQueueDropsDesc  *prometheus.Desc
+	libvirtDomainInterfaceNWFilterRulesDesc *prometheus.Desc
+	libvirtDomainInterfaceMTUDesc           *prometheus.Desc
+	libvirtDomainInterfaceTapMTUDesc        *prometheus.Desc
+	libvirtDomainInterfaceBridgeMTUDesc     *prometheus.Desc
+	libvirtDomainInterfaceMTUMismatchDesc   *prometheus.Desc
+}
+
+// domainStates maps the states of domains to the values of the state
+// label of libvirt_domain_state.
+var domainStates = []struct {
+	state libvirt.DomainState
+	name  string
+}{
+	{libvirt.DOMAIN_NOSTATE, "nostate"},
+	{libvirt.DOMAIN_RUNNING, "running"},
+	{libvirt.DOMAIN_BLOCKED, "blocked"},
+	{libvirt.DOMAIN_PAUSED, "paused"},
+	{libvirt.DOMAIN_SHUTDOWN, "shutdown"},
+	{libvirt.DOMAIN_SHUTOFF, "shutoff"},
+	{libvirt.DOMAIN_CRASHED, "crashed"},
+	{libvirt.DOMAIN_PMSUSPENDED, "pmsuspended"},
+}
+
+// BlockSourceLabels lists the disk attributes that can be used as the
+// value of the source_file label of block device metrics.
+var BlockSourceLabels = []string{"file", "dev", "volume", "source", "serial", "alias"}
+
+// LibvirtExporterOptions configures a LibvirtExporter.
+type LibvirtExporterOptions struct {
+	URI                string
+	ExportNovaMetadata bool
+	ExportNanoseconds  bool
+	BlockSourceLabel   string
+	// Logger and Pool may be shared by the exporters of several URIs.
+	// Their metrics are not reported by the exporter.
+	Logger        *ThrottledLogger
+	Pool          *ConnPool
+	SwtpmStateDir string
+	ExportVolumes bool
+	// ExportNWFilters enables counting the rules of the network filters
+	// of interfaces, which requires looking up every referenced filter.
+	ExportNWFilters bool
+	// ExportBlockIoTune enables reporting the I/O limits of disks, which
+	// requires a call to libvirt for every disk.
+	ExportBlockIoTune bool
+	// CollectorIntervals maps the names of collectors to the interval at
+	// which they run in the background. Collectors without an interval
+	// run on every scrape.
+	CollectorIntervals map[string]time.Duration
+	// DomainFilter, if set, restricts collection to the domains whose
+	// name it matches.
+	DomainFilter *regexp.Regexp
+	// DomainUUIDs, if set, restricts collection to the domains whose
+	// UUID it holds. It may be shared by the exporters of several URIs.
+	DomainUUIDs     *UUIDAllowlist
+	IncludeInactive bool
+	// DisabledCollectors holds the names of the optional collectors that
+	// are disabled.
+	DisabledCollectors map[string]bool
+	// MaxConcurrentCollects is the maximum number of domains whose
+	// metrics are collected concurrently.
+	MaxConcurrentCollects int
+	// DomainLabelRenames maps labels attached to all metrics of a domain
+	// (domain, resource_id and, with Nova metadata, name, flavor,
+	// user_id and project_id) to the name they are exported with.
+	// DroppedDomainLabels holds those that are not exported at all.
+	DomainLabelRenames  map[string]string
+	DroppedDomainLabels map[string]bool
+	// WatchDomainEvents enables recording the changes of the definition
+	// of domains from libvirt events, which requires the event loop to
+	// have been started with StartEventLoop.
+	WatchDomainEvents bool
+	// CgroupFallback enables reading the CPU time and I/O of running
+	// domains from their cgroup when libvirt fails to report them. It is
+	// only supported for local URIs on Linux.
+	CgroupFallback bool
+	// ResolveHostDevices enables reporting the host block devices, such
+	// as dm-3, backing the block disks of domains, and the paths of
+	// multipath devices. It is only supported for local URIs.
+	ResolveHostDevices bool
+	// SecurityAuditLog, if set, is the path of the audit log from which
+	// the AppArmor and SELinux denials of domains are counted. It is only
+	// supported for local URIs.
+	SecurityAuditLog string
+	// BackupNamespace, if set, is the namespace of the element of
+	// the metadata of domains holding the time of their last successful
+	// backup.
+	BackupNamespace string
+	// ExportCheckpoints enables reporting the creation time of the latest
+	// checkpoint of domains without a backup time in their metadata, as
+	// the time of their last backup.
+	ExportCheckpoints bool
+	// ExportPendingReboot enables reporting the changes to the persistent
+	// configuration of running domains that only take effect once they
+	// are restarted, which requires a call to libvirt for every domain.
+	ExportPendingReboot bool
+	// ExportGuestDisks enables reporting the devices the disks of running
+	// domains appear as in their guest, which requires a call to the
+	// guest agent of every domain.
+	ExportGuestDisks bool
+	// BreakerThreshold, if positive, is the number of consecutive
+	// failures to connect to libvirt after which connecting is skipped
+	// for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// HostLimiter, if set, limits the number of hosts collected
+	// concurrently. It may be shared by the exporters of several URIs.
+	HostLimiter *HostLimiter
+	// ConfigHash is a hash of the settings the options were derived
+	// from, reported by libvirt_exporter_config_info.
+	ConfigHash string
+	// Tracer, if set, traces the runs of collectors, whose trace IDs are
+	// attached to libvirt_collector_duration_seconds as exemplars. It may
+	// be shared by the exporters of several URIs.
+	Tracer trace.Tracer
+}
+
+// NewLibvirtExporter creates a new Prometheus exporter for libvirt.
+func NewLibvirtExporter(opts LibvirtExporterOptions) (*LibvirtExporter, error) {
+	validBlockSourceLabel := false
+	for _, label := range BlockSourceLabels {
+		if opts.BlockSourceLabel == label {
+			validBlockSourceLabel = true
+		}
+	}
+	if !validBlockSourceLabel {
+		return nil, fmt.Errorf("invalid block source label %q, must be one of %s", opts.BlockSourceLabel, strings.Join(BlockSourceLabels, ", "))
+	}
+
+	for name := range opts.CollectorIntervals {
+		if !isCollectorName(name) {
+			return nil, fmt.Errorf("invalid collector %q, must be one of %s", name, strings.Join(CollectorNames, ", "))
+		}
+	}
+	for name := range opts.DisabledCollectors {
+		if !isOptionalCollectorName(name) {
+			return nil, fmt.Errorf("invalid collector %q, must be one of %s", name, strings.Join(OptionalCollectorNames, ", "))
+		}
+	}
+
+	if opts.MaxConcurrentCollects < 1 {
+		return nil, fmt.Errorf("invalid maximum number of concurrent collections %d, must be at least 1", opts.MaxConcurrentCollects)
+	}
+
+	var domainLabels []string
+	if opts.ExportNovaMetadata {
+		domainLabels = []string{"domain", "resource_id", "name", "flavor", "user_id", "project_id"}
+	} else {
+		domainLabels = []string{"domain", "resource_id"}
+	}
+	domainLabels, keptDomainLabels, err := mapDomainLabels(domainLabels, opts.DomainLabelRenames, opts.DroppedDomainLabels)
+	if err != nil {
+		return nil, err
+	}
+	infos := infoDescs{}
+	e := &LibvirtExporter{
+		uri:                opts.URI,
+		local:              isLocalURI(opts.URI),
+		exportNovaMetadata: opts.ExportNovaMetadata,
+		exportNanoseconds:  opts.ExportNanoseconds,
+		blockSourceLabel:   opts.BlockSourceLabel,
+		swtpmStateDir:      opts.SwtpmStateDir,
+		exportVolumes:      opts.ExportVolumes,
+		exportNWFilters:    opts.ExportNWFilters,
+		exportBlockIoTune:  opts.ExportBlockIoTune,
+		domainFilter:       opts.DomainFilter,
+		domainUUIDs:        opts.DomainUUIDs,
+		includeInactive:    opts.IncludeInactive,
+		disabled:           opts.DisabledCollectors,
+		maxConcurrent:      opts.MaxConcurrentCollects,
+		domainLabels:       domainLabels,
+		keptDomainLabels:   keptDomainLabels,
+		logger:             opts.Logger,
+		pool:               opts.Pool,
+		stop:               make(chan struct{}),
+		watchEvents:        opts.WatchDomainEvents,
+		cgroupFallback:     opts.CgroupFallback,
+		resolveHostDevices: opts.ResolveHostDevices,
+		backupNamespace:    opts.BackupNamespace,
+		exportCheckpoints:  opts.ExportCheckpoints,
+		pendingReboot:      opts.ExportPendingReboot,
+		exportGuestDisks:   opts.ExportGuestDisks,
+		configLabelValues:  configInfoLabelValues(opts),
+		domainEvents:       newDomainEvents(),
+		infoLabels:         infos,
+		labelValues:        newLabelInterner(),
+		breaker:            newCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+		hostLimiter:        opts.HostLimiter,
+		tracer:             opts.Tracer,
+		libvirtUpDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "", "up"),
+			"Whether scraping libvirt's metrics was successful.",
+			nil,
+			nil),
+		libvirtScrapeDurationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "scrape", "duration_seconds"),
+			"Duration of the last run of a collector, in seconds.",
+			[]string{"collector"},
+			nil),
+		libvirtScrapeDomainsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "scrape", "domains"),
+			"Number of domains whose metrics were collected by the last run of the domains collector.",
+			nil,
+			nil),
+		libvirtScrapeSkippedDomainsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "scrape", "skipped_domains"),
+			"Number of domains whose metrics were not collected by the last run of the domains collector, by reason (filtered or error).",
+			[]string{"reason"},
+			nil),
+		libvirtDomainConfigChangesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "config_changes_total"),
+			"Number of changes of the definition of domains reported by libvirt events, by event (defined or undefined) and detail (added, updated, renamed, from_snapshot or removed).",
+			[]string{"event", "detail"},
+			nil),
+		libvirtDomainConfigChangedTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "config_changed_timestamp_seconds"),
+			"Time at which the definition of the domain last changed, as reported by libvirt events, in seconds since the Unix epoch.",
+			domainLabels,
+			nil),
+		libvirtExporterScrapesTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "libvirt_exporter",
+				Name:      "scrapes_total",
+				Help:      "Number of times metrics were scraped from the exporter.",
+			}),
+		libvirtExporterLastScrapeTimestamp: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: "libvirt_exporter",
+				Name:      "last_scrape_timestamp_seconds",
+				Help:      "Time at which metrics were last scraped from the exporter, in seconds since the Epoch.",
+			}),
+		libvirtCollectorDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "libvirt",
+				Name:      "collector_duration_seconds",
+				Help:      "Duration of the runs of collectors, in seconds, with the trace IDs of sampled runs as exemplars when tracing is enabled.",
+				Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+			},
+			[]string{"collector"}),
+		libvirtExporterPanicsRecovered: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "libvirt_exporter",
+				Name:      "panics_recovered_total",
+				Help:      "Number of panics that were recovered from while collecting metrics, by collector.",
+			},
+			[]string{"collector"}),
+		libvirtExporterInternedLabelsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt_exporter", "", "interned_label_values"),
+			"Number of distinct label values of domain metrics shared across scrapes to reduce memory usage.",
+			nil,
+			nil),
+		libvirtExporterCircuitOpenDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt_exporter", "", "circuit_open"),
+			"Whether connecting to libvirt is skipped after repeated failures, until a cooldown period expires.",
+			nil,
+			nil),
+		libvirtHostTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_time", "seconds"),
+			"Time of the host, in seconds since the Epoch.",
+			nil,
+			nil),
+		libvirtHostTimeSyncStatusDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_time", "sync_status"),
+			"Whether the clock of the host is synchronized to a reliable time source.",
+			nil,
+			nil),
+		libvirtHostTimeOffsetDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_time", "offset_seconds"),
+			"Time offset between the clock of the host and its time source, in seconds.",
+			nil,
+			nil),
+		libvirtHostTimeMaxErrorDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_time", "maximum_error_seconds"),
+			"Maximum error of the clock of the host, in seconds.",
+			nil,
+			nil),
+		libvirtHostTimeEstimatedErrorDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_time", "estimated_error_seconds"),
+			"Estimated error of the clock of the host, in seconds.",
+			nil,
+			nil),
+		libvirtHostHardwareInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "host", "hardware_info"),
+			"Hardware of the host, as reported by its SMBIOS.",
+			[]string{"vendor", "product", "serial", "bios_version"}),
+		libvirtHostMaintenanceDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "maintenance"),
+			"Whether the host is in maintenance mode.",
+			nil,
+			nil),
+		libvirtExporterConfigDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt_exporter", "config", "info"),
+			"Settings of the exporter: enabled optional collectors, intervals of background collectors, domain filters and a hash of all settings.",
+			configInfoLabels),
+		libvirtHostDomainsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "domains"),
+			"Number of domains on the host, by state (active or inactive) and persistence (persistent or transient).",
+			[]string{"state", "persistence"},
+			nil),
+		libvirtHostVersionInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "host", "version_info"),
+			"Versions of the hypervisor and of libvirt on the host.",
+			[]string{"hypervisor_version", "libvirt_version"}),
+		libvirtHostMemoryDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "memory_bytes"),
+			"Amount of memory of the host, in bytes.",
+			nil,
+			nil),
+		libvirtHostCpusDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpus"),
+			"Number of active CPUs of the host, by model.",
+			[]string{"model"},
+			nil),
+		libvirtHostCpuFrequencyDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_frequency_hertz"),
+			"Expected frequency of the CPUs of the host, in hertz.",
+			nil,
+			nil),
+		libvirtHostNumaNodesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "numa_nodes"),
+			"Number of NUMA nodes of the host, or 1 if its topology is not regular.",
+			nil,
+			nil),
+		libvirtHostCpuSocketsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_sockets_per_node"),
+			"Number of CPU sockets per NUMA node of the host.",
+			nil,
+			nil),
+		libvirtHostCpuCoresDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_cores_per_socket"),
+			"Number of CPU cores per socket of the host.",
+			nil,
+			nil),
+		libvirtHostCpuThreadsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_threads_per_core"),
+			"Number of CPU threads per core of the host.",
+			nil,
+			nil),
+		libvirtHostCpuScalingFrequencyDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_scaling_frequency_hertz"),
+			"Current frequency of a CPU of the host, as set by frequency scaling, in hertz.",
+			[]string{"cpu"},
+			nil),
+		libvirtHostCpuScalingMaxFrequencyDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_scaling_frequency_max_hertz"),
+			"Maximum frequency a CPU of the host may be set to by frequency scaling, in hertz.",
+			[]string{"cpu"},
+			nil),
+		libvirtHostCpuPackageThrottlesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_package_throttles_total"),
+			"Number of times a CPU package of the host was throttled because its temperature was too high.",
+			[]string{"package"},
+			nil),
+		libvirtHostCpuTemperatureDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "cpu_temperature_celsius"),
+			"Temperature of a CPU package of the host, as reported by a hardware monitoring chip, in degrees Celsius.",
+			[]string{"chip", "device", "sensor"},
+			nil),
+		libvirtHostMemoryStatsTotalDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_memory_stats", "total_bytes"),
+			"Total amount of memory usable by the host, in bytes.",
+			nil,
+			nil),
+		libvirtHostMemoryStatsFreeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_memory_stats", "free_bytes"),
+			"Amount of free memory of the host, in bytes.",
+			nil,
+			nil),
+		libvirtHostMemoryStatsBuffDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_memory_stats", "buffers_bytes"),
+			"Amount of memory of the host used for buffers, in bytes.",
+			nil,
+			nil),
+		libvirtHostMemoryStatsCacheDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_memory_stats", "cached_bytes"),
+			"Amount of memory of the host used for the page cache, in bytes.",
+			nil,
+			nil),
+		libvirtHostDomainsMemoryBalloonDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_domains", "memory_balloon_bytes"),
+			"Sum of the current balloon sizes of the active domains of the host, in bytes.",
+			nil,
+			nil),
+		libvirtHostDomainsMemoryMaximumDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_domains", "memory_maximum_bytes"),
+			"Sum of the maximum memory of the active domains of the host, in bytes.",
+			nil,
+			nil),
+		libvirtHostMemoryHeadroomDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "memory_headroom_bytes"),
+			"Amount of free memory of the host that would remain if all active domains grew their balloon to their maximum memory, in bytes. It is negative when the host is overcommitted.",
+			nil,
+			nil),
+		libvirtHostGraphicsPortsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_graphics", "ports"),
+			"Number of TCP ports on which the VNC and SPICE servers of the active domains of the host listen.",
+			nil,
+			nil),
+		libvirtHostGraphicsPortConflictsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_graphics", "port_conflicts"),
+			"Number of TCP ports claimed by the VNC or SPICE servers of several active domains of the host on overlapping addresses.",
+			nil,
+			nil),
+		libvirtHostGraphicsUnallocatedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host_graphics", "unallocated_ports"),
+			"Number of VNC and SPICE servers of active domains of the host listening on TCP without any allocated port, typically because autoport failed.",
+			nil,
+			nil),
+		libvirtStoragePoolStateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "storage_pool", "state"),
+			"State of the storage pool (inactive, building, running, degraded or inaccessible). The value is 1 for the current state, 0 for all others.",
+			[]string{"pool", "type", "state"},
+			nil),
+		libvirtStoragePoolCapacityDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "storage_pool", "capacity_bytes"),
+			"Logical size of the storage pool, in bytes.",
+			[]string{"pool", "type"},
+			nil),
+		libvirtStoragePoolAllocationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "storage_pool", "allocation_bytes"),
+			"Amount of storage allocated to the volumes of the storage pool, in bytes.",
+			[]string{"pool", "type"},
+			nil),
+		libvirtStoragePoolAvailableDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "storage_pool", "available_bytes"),
+			"Amount of storage available for new volumes in the storage pool, in bytes.",
+			[]string{"pool", "type"},
+			nil),
+		libvirtStorageVolCapacityDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "storage_volume", "capacity_bytes"),
+			"Logical size of the storage volume, in bytes.",
+			[]string{"pool", "volume", "type"},
+			nil),
+		libvirtStorageVolAllocationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "storage_volume", "allocation_bytes"),
+			"Amount of storage allocated to the storage volume, in bytes.",
+			[]string{"pool", "volume", "type"},
+			nil),
+		libvirtErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "libvirt",
+				Name:      "errors_total",
+				Help:      "Number of errors reported by libvirt while collecting metrics, by numeric virErrorNumber code and API call.",
+			},
+			[]string{"code", "proc"}),
+		libvirtDomainScrapeErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "libvirt",
+				Subsystem: "domain",
+				Name:      "scrape_errors_total",
+				Help:      "Number of errors encountered while collecting metrics of a domain or of one of its devices.",
+			},
+			[]string{"domain"}),
+		libvirtDomainCgroupFallbacks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "libvirt",
+				Subsystem: "domain_cgroup",
+				Name:      "fallbacks_total",
+				Help:      "Number of times statistics of a domain that libvirt failed to report were read from its cgroup instead, by statistics (cpu or block).",
+			},
+			[]string{"stats"}),
+		libvirtDomainCgroupIOReadBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cgroup", "io_read_bytes_total"),
+			"Number of bytes read by the domain from host block devices, read from its cgroup when libvirt fails to report block statistics.",
+			domainLabels,
+			nil),
+		libvirtDomainCgroupIOWriteBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cgroup", "io_write_bytes_total"),
+			"Number of bytes written by the domain to host block devices, read from its cgroup when libvirt fails to report block statistics.",
+			domainLabels,
+			nil),
+		libvirtDomainCgroupIOReadReqsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cgroup", "io_read_requests_total"),
+			"Number of read requests made by the domain to host block devices, read from its cgroup when libvirt fails to report block statistics.",
+			domainLabels,
+			nil),
+		libvirtDomainCgroupIOWriteReqsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cgroup", "io_write_requests_total"),
+			"Number of write requests made by the domain to host block devices, read from its cgroup when libvirt fails to report block statistics.",
+			domainLabels,
+			nil),
+		libvirtDomainBlkioWeightDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_blkio", "weight"),
+			"Weight of the domain for proportional I/O scheduling, as configured in libvirt.",
+			domainLabels,
+			nil),
+		libvirtDomainBlkioCgroupWeightDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_blkio", "cgroup_weight"),
+			"Weight of the domain for proportional I/O scheduling, as read from its cgroup.",
+			domainLabels,
+			nil),
+		libvirtDomainBlkioWeightMismatchDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_blkio", "weight_mismatch"),
+			"Whether the I/O weight of the domain in its cgroup differs from that configured in libvirt.",
+			domainLabels,
+			nil),
+		libvirtDomainSecurityDenialsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "security_denials_total"),
+			"Number of AppArmor or SELinux denials logged in the audit log for the security label of the domain since the exporter started, by model (apparmor or selinux).",
+			append(domainLabels, "model"),
+			nil),
+		libvirtDomainLastBackupDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "last_backup_timestamp_seconds"),
+			"Time of the last successful backup of the domain, as recorded in its metadata or by its latest checkpoint, in seconds since the Unix epoch.",
+			domainLabels,
+			nil),
+		libvirtDomainXMLParseFailedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_xml", "parse_failed"),
+			"Whether the current XML description of the domain could not be parsed completely, in which case labels and metrics derived from it may be missing.",
+			domainLabels,
+			nil),
+		libvirtDomainXMLUnknownFieldsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_xml", "unknown_fields"),
+			"Number of occurrences of an attribute or element in the XML description of a domain that is not understood by the exporter.",
+			append(domainLabels, "field"),
+			nil),
+		libvirtDomainInfoMaxMemDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_info", "maximum_memory_bytes"),
+			"Maximum allowed memory of the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainInfoMemoryDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_info", "memory_usage_bytes"),
+			"Memory usage of the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainInfoNrVirtCpuDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_info", "virtual_cpus"),
+			"Number of virtual CPUs for the domain.",
+			domainLabels,
+			nil),
+		libvirtDomainInfoCpuTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_info", "cpu_time_seconds_total"),
+			"Amount of CPU time used by the domain, in seconds.",
+			domainLabels,
+			nil),
+		libvirtDomainInfoCpuTimeNsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_info", "cpu_time_nanoseconds_total"),
+			"Amount of CPU time used by the domain, in nanoseconds.",
+			domainLabels,
+			nil),
+		libvirtDomainInfoIdDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_info", "id"),
+			"Identifier of the running domain, as shown by 'virsh list'. It changes every time the domain is started.",
+			domainLabels,
+			nil),
+		libvirtDomainInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain", "info"),
+			"Configuration of the domain, as described by its XML.",
+			append(domainLabels, "hypervisor_type", "os_type", "arch", "machine")),
+		libvirtDomainStateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "state"),
+			"State of the domain (nostate, running, blocked, paused, shutdown, shutoff, crashed or pmsuspended). The value is 1 for the current state, 0 for all others.",
+			append(domainLabels, "state"),
+			nil),
+		libvirtDomainOpenstackInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain", "openstack_info"),
+			"OpenStack Nova instance of the domain, as described by the metadata of its XML.",
+			[]string{"domain", "resource_id", "instance_name", "flavor", "project_id", "project_name", "user_id", "user_name"}),
+		libvirtDomainVcpuTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_vcpu", "time_seconds_total"),
+			"Amount of CPU time used by a virtual CPU of the domain, in seconds.",
+			append(domainLabels, "vcpu"),
+			nil),
+		libvirtDomainVcpuTimeNsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_vcpu", "time_nanoseconds_total"),
+			"Amount of CPU time used by a virtual CPU of the domain, in nanoseconds.",
+			append(domainLabels, "vcpu"),
+			nil),
+		libvirtDomainJobInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "info"),
+			"Type (bounded or unbounded) and operation of the job running on the domain, such as a migration.",
+			append(domainLabels, "type", "operation")),
+		libvirtDomainJobElapsedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "elapsed_seconds"),
+			"Time elapsed since the job running on the domain started, in seconds.",
+			domainLabels,
+			nil),
+		libvirtDomainJobRemainingDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "remaining_seconds"),
+			"Estimated time remaining until the bounded job running on the domain completes, in seconds.",
+			domainLabels,
+			nil),
+		libvirtDomainJobDowntimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "downtime_seconds"),
+			"Expected downtime of the domain at the end of the migration running on it, in seconds.",
+			domainLabels,
+			nil),
+		libvirtDomainJobDataTotalDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "data_total_bytes"),
+			"Amount of data to be processed by the job running on the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainJobDataProcessedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "data_processed_bytes"),
+			"Amount of data processed by the job running on the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainJobDataRemainingDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "data_remaining_bytes"),
+			"Amount of data remaining to be processed by the job running on the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainJobMemoryDirtyRateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "memory_dirty_rate_bytes_per_second"),
+			"Rate at which the memory of the domain is dirtied during the migration running on it, in bytes per second.",
+			domainLabels,
+			nil),
+		libvirtDomainJobMemoryIterationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_job", "memory_iteration"),
+			"Number of iterations over the memory of the domain performed by the migration running on it.",
+			domainLabels,
+			nil),
+		libvirtDomainTPMEmulatorUpDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_tpm", "emulator_up"),
+			"Whether the swtpm process backing an emulated TPM of the running domain is alive and listening on its socket.",
+			append(domainLabels, "model", "version"),
+			nil),
+		libvirtDomainChannelConnectedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_channel", "connected"),
+			"Whether the guest side of a virtio channel of the running domain, such as the one of the QEMU guest agent, is connected.",
+			append(domainLabels, "channel"),
+			nil),
+		libvirtDomainClockInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_clock", "info"),
+			"Configuration of the clock of the domain: offset from the host clock (utc, localtime, timezone or variable), basis of variable clocks and timezone.",
+			append(domainLabels, "offset", "basis", "timezone")),
+		libvirtDomainClockAdjustmentDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_clock", "adjustment_seconds"),
+			"Offset of the variable clock of the domain from its basis, in seconds.",
+			domainLabels,
+			nil),
+		libvirtDomainClockTimerInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_clock", "timer_info"),
+			"Configuration of a timer of the domain, such as kvmclock, hpet or tsc.",
+			append(domainLabels, "timer", "present", "tickpolicy", "track", "mode", "frequency")),
+		libvirtDomainHyperVInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_hyperv", "info"),
+			"Whether Hyper-V enlightenments are configured for the domain, and their mode (custom or passthrough).",
+			append(domainLabels, "mode")),
+		libvirtDomainHyperVEnlightenmentDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_hyperv", "enlightenment_info"),
+			"Hyper-V enlightenment configured for the domain, such as relaxed, vapic, spinlocks or stimer, and its state.",
+			append(domainLabels, "enlightenment", "state")),
+		libvirtDomainHyperVSpinlockRetriesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_hyperv", "spinlock_retries"),
+			"Number of times a virtual CPU of the domain retries to acquire a spinlock before notifying the hypervisor, with the Hyper-V spinlocks enlightenment.",
+			domainLabels,
+			nil),
+		libvirtDomainPlatformFeatureDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain", "platform_feature_info"),
+			"Feature of the domain specific to the aarch64 or ppc64 architectures, such as the version of the GIC on aarch64 or HTM on ppc64, and its setting.",
+			append(domainLabels, "feature", "setting")),
+		libvirtDomainNestedVirtualizationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "nested_virtualization"),
+			"Whether the domain can run its own virtual machines, as its virtual CPU exposes the hardware virtualization extensions (vmx or svm) to the guest or, on ppc64, its nested-hv feature is enabled, by CPU mode.",
+			append(domainLabels, "cpu_mode"),
+			nil),
+		libvirtHostNestedVirtualizationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "host", "nested_virtualization"),
+			"Whether nested virtualization is enabled in a KVM module (kvm_intel, kvm_amd or kvm_hv) of the host.",
+			[]string{"module"},
+			nil),
+		libvirtDomainCPUSocketsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cpu", "sockets"),
+			"Number of CPU sockets of the domain, as configured in the topology of its virtual CPUs.",
+			domainLabels,
+			nil),
+		libvirtDomainCPUDiesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cpu", "dies_per_socket"),
+			"Number of dies per CPU socket of the domain, as configured in the topology of its virtual CPUs.",
+			domainLabels,
+			nil),
+		libvirtDomainCPUCoresDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cpu", "cores_per_die"),
+			"Number of cores per CPU die of the domain, as configured in the topology of its virtual CPUs.",
+			domainLabels,
+			nil),
+		libvirtDomainCPUThreadsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cpu", "threads_per_core"),
+			"Number of threads per CPU core of the domain, as configured in the topology of its virtual CPUs.",
+			domainLabels,
+			nil),
+		libvirtDomainPendingRebootDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "pending_reboot"),
+			"Whether the persistent configuration of the running domain differs from its live configuration in a way that only takes effect once it is restarted, by change (machine, cpu or vcpus).",
+			append(domainLabels, "change"),
+			nil),
+		libvirtDomainDevicesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain", "devices"),
+			"Number of disks and network interfaces of the domain, by kind, model (bus of disks, model of interfaces) and class (paravirtual, emulated or passthrough).",
+			append(domainLabels, "kind", "model", "class"),
+			nil),
+		libvirtDomainGraphicsInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_graphics", "info"),
+			"VNC or SPICE server of the domain, with its ports (-1 until allocated), listen address and whether ports are allocated automatically.",
+			append(domainLabels, "type", "port", "tls_port", "listen", "autoport")),
+		libvirtDomainCacheTuneSizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_cachetune", "size_bytes"),
+			"Size of the host cache allocated to a set of virtual CPUs of the domain through resctrl, in bytes.",
+			append(domainLabels, "vcpus", "cache", "level", "type"),
+			nil),
+		libvirtDomainShmemSizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_shmem", "size_bytes"),
+			"Size of a shared memory device of the domain, in bytes.",
+			append(domainLabels, "shmem", "model"),
+			nil),
+		libvirtDomainMemoryTuneBandwidthDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memorytune", "bandwidth"),
+			"Memory bandwidth allocated to a set of virtual CPUs of the domain through resctrl on a host memory controller, as a percentage, or in MiB/s if resctrl is mounted with mba_MBps.",
+			append(domainLabels, "vcpus", "node"),
+			nil),
+		libvirtDomainMemoryStatsActualBalloonDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "actual_balloon_bytes"),
+			"Current balloon size of the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsAvailableDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "available_bytes"),
+			"Amount of usable memory as seen by the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsUnusedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "unused_bytes"),
+			"Amount of memory left completely unused by the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsUsableDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "usable_bytes"),
+			"Amount of memory which can be reclaimed by the balloon without causing host swapping, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsRssDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "rss_bytes"),
+			"Resident set size of the process running the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsDiskCachesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "disk_caches_bytes"),
+			"Amount of memory that can be quickly reclaimed from disk caches by the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsSwapInDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "swap_in_bytes_total"),
+			"Amount of memory swapped in by the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsSwapOutDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "swap_out_bytes_total"),
+			"Amount of memory swapped out by the domain, in bytes.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsMajorFaultDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "major_faults_total"),
+			"Number of page faults of the domain that required disk I/O.",
+			domainLabels,
+			nil),
+		libvirtDomainMemoryStatsMinorFaultDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_memory_stats", "minor_faults_total"),
+			"Number of page faults of the domain that did not require disk I/O.",
+			domainLabels,
+			nil),
+		libvirtDomainBlockCapacityDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "capacity_bytes"),
+			"Logical size of a block device, as seen by the domain, in bytes.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockAllocationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "allocation_bytes"),
+			"Highest written offset of a block device in its backing storage, or amount of storage allocated to it, in bytes.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockPhysicalSizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "physicalsize_bytes"),
+			"Physical size of the storage backing a block device, such as the size of its image file, in bytes.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockEncryptedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "encrypted"),
+			"Whether a block device is encrypted, and in which format.",
+			append(domainLabels, "source_file", "target_device", "format"),
+			nil),
+		libvirtDomainBlockInfoDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "info"),
+			"Storage backing a block device, whatever its type, and format of its image.",
+			append(domainLabels, "source_file", "target_device", "source", "disk_type", "driver_type")),
+		libvirtDomainBlockHostDeviceDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "host_device_info"),
+			"Host block device backing a block device, as named in /proc/diskstats.",
+			append(domainLabels, "source_file", "target_device", "host_device")),
+		libvirtDomainBlockGuestDeviceDesc: infos.newDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "guest_device_info"),
+			"Device a block device appears as in the guest, as reported by the QEMU guest agent, with the serial number of the disk.",
+			append(domainLabels, "source_file", "target_device", "serial", "guest_device")),
+		libvirtDomainBlockMultipathPathsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "multipath_paths"),
+			"Number of paths of the host multipath device backing a block device.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockMultipathActivePathsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block", "multipath_active_paths"),
+			"Number of paths of the host multipath device backing a block device whose SCSI device is running.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockIoTuneBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_iotune", "bytes_per_second"),
+			"Throughput limit of a block device, in bytes per second.",
+			append(domainLabels, "source_file", "target_device", "direction"),
+			nil),
+		libvirtDomainBlockIoTuneIopsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_iotune", "iops"),
+			"Limit of I/O operations per second of a block device.",
+			append(domainLabels, "source_file", "target_device", "direction"),
+			nil),
+		libvirtDomainBlockIoTuneBurstBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_iotune", "burst_bytes_per_second"),
+			"Throughput limit of a block device during bursts, in bytes per second.",
+			append(domainLabels, "source_file", "target_device", "direction"),
+			nil),
+		libvirtDomainBlockIoTuneBurstIopsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_iotune", "burst_iops"),
+			"Limit of I/O operations per second of a block device during bursts.",
+			append(domainLabels, "source_file", "target_device", "direction"),
+			nil),
+		libvirtDomainBlockRdBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "read_bytes_total"),
+			"Number of bytes read from a block device, in bytes.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockRdReqDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "read_requests_total"),
+			"Number of read requests from a block device.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockRdTotalTimesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "read_seconds_total"),
+			"Amount of time spent reading from a block device, in seconds.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockWrBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "write_bytes_total"),
+			"Number of bytes written from a block device, in bytes.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+
+		libvirtDomainBlockWrReqDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "write_requests_total"),
+			"Number of write requests from a block device.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockWrTotalTimesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "write_seconds_total"),
+			"Amount of time spent writing from a block device, in seconds.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockFlushReqDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "flush_requests_total"),
+			"Number of flush requests from a block device.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockFlushTotalTimesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "flush_seconds_total"),
+			"Amount of time spent flushing of a block device, in seconds.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockRdTotalTimesNsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "read_nanoseconds_total"),
+			"Amount of time spent reading from a block device, in nanoseconds.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockWrTotalTimesNsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "write_nanoseconds_total"),
+			"Amount of time spent writing from a block device, in nanoseconds.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+		libvirtDomainBlockFlushTotalTimesNsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_block_stats", "flush_nanoseconds_total"),
+			"Amount of time spent flushing of a block device, in nanoseconds.",
+			append(domainLabels, "source_file", "target_device"),
+			nil),
+
+		libvirtDomainInterfaceRxBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "receive_bytes_total"),
+			"Number of bytes received on a network interface, in bytes.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceRxPacketsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "receive_packets_total"),
+			"Number of packets received on a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceRxErrsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "receive_errors_total"),
+			"Number of packet receive errors on a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceRxDropDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "receive_drops_total"),
+			"Number of packet receive drops on a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceTxBytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "transmit_bytes_total"),
+			"Number of bytes transmitted on a network interface, in bytes.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceTxPacketsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "transmit_packets_total"),
+			"Number of packets transmitted on a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceTxErrsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "transmit_errors_total"),
+			"Number of packet transmit errors on a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceTxDropDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "transmit_drops_total"),
+			"Number of packet transmit drops on a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+
+		libvirtDomainInterfaceQueuesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface", "queues"),
+			"Number of queues of the tap device of a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceQueueLengthDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface", "queue_length"),
+			"Number of packets that each queue of the tap device of a network interface can hold.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceRxQueueDropsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "receive_queue_drops_total"),
+			"Number of packets towards the guest dropped by the tap device of a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceTxQueueDropsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface_stats", "transmit_queue_drops_total"),
+			"Number of packets from the guest dropped by the tap device of a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceMTUDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface", "mtu_bytes"),
+			"MTU of a network interface, as configured in the domain.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceTapMTUDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface", "tap_mtu_bytes"),
+			"MTU of the tap device of the host backing a network interface.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceBridgeMTUDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface", "bridge_mtu_bytes"),
+			"MTU of the bridge of the host to which a network interface is attached.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceMTUMismatchDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface", "mtu_mismatch"),
+			"Whether the MTUs of a network interface, of its tap device and of its bridge differ.",
+			append(domainLabels, "source_bridge", "target_device"),
+			nil),
+		libvirtDomainInterfaceNWFilterRulesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt", "domain_interface", "nwfilter_rules"),
+			"Number of rules of the network filter of a network interface, including those of the filters it references.",
+			append(domainLabels, "source_bridge", "target_device", "filter"),
+			nil),
+	}
+	for _, c := range []struct {
+		name    string
+		collect func(ch chan<- prometheus.Metric) error
+	}{
+		{"host", e.CollectHost},
+		{"storage", e.CollectStorage},
+		{"domains", e.CollectDomains},
+	} {
+		if e.disabled[c.name] {
+			continue
+		}
+		e.collectors = append(e.collectors, newScheduledCollector(e, c.name, opts.CollectorIntervals[c.name], c.collect))
+	}
+	if opts.SecurityAuditLog != "" && e.local {
+		e.securityDenials = newSecurityDenials(opts.SecurityAuditLog)
+	}
+	return e, nil
+}
+
+// Describe returns metadata for all Prometheus metrics that may be exported.
+func (e *LibvirtExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.libvirtUpDesc
+	ch <- e.libvirtScrapeDurationDesc
+	ch <- e.libvirtScrapeDomainsDesc
+	ch <- e.libvirtScrapeSkippedDomainsDesc
+	ch <- e.libvirtDomainConfigChangesDesc
+	ch <- e.libvirtDomainConfigChangedTimeDesc
+	e.libvirtExporterScrapesTotal.Describe(ch)
+	e.libvirtExporterLastScrapeTimestamp.Describe(ch)
+	e.libvirtExporterPanicsRecovered.Describe(ch)
+	e.libvirtCollectorDuration.Describe(ch)
+	ch <- e.libvirtExporterInternedLabelsDesc
+	ch <- e.libvirtExporterCircuitOpenDesc
+	ch <- e.libvirtHostTimeDesc
+	ch <- e.libvirtHostTimeSyncStatusDesc
+	ch <- e.libvirtHostTimeOffsetDesc
+	ch <- e.libvirtHostTimeMaxErrorDesc
+	ch <- e.libvirtHostTimeEstimatedErrorDesc
+	ch <- e.libvirtHostHardwareInfoDesc
+	ch <- e.libvirtHostMaintenanceDesc
+	ch <- e.libvirtExporterConfigDesc
+	ch <- e.libvirtHostDomainsDesc
+	ch <- e.libvirtHostVersionInfoDesc
+	ch <- e.libvirtHostMemoryDesc
+	ch <- e.libvirtHostCpusDesc
+	ch <- e.libvirtHostCpuFrequencyDesc
+	ch <- e.libvirtHostNumaNodesDesc
+	ch <- e.libvirtHostCpuSocketsDesc
+	ch <- e.libvirtHostCpuCoresDesc
+	ch <- e.libvirtHostCpuThreadsDesc
+	ch <- e.libvirtHostCpuScalingFrequencyDesc
+	ch <- e.libvirtHostCpuScalingMaxFrequencyDesc
+	ch <- e.libvirtHostCpuPackageThrottlesDesc
+	ch <- e.libvirtHostCpuTemperatureDesc
+	ch <- e.libvirtHostMemoryStatsTotalDesc
+	ch <- e.libvirtHostMemoryStatsFreeDesc
+	ch <- e.libvirtHostMemoryStatsBuffDesc
+	ch <- e.libvirtHostMemoryStatsCacheDesc
+	ch <- e.libvirtHostDomainsMemoryBalloonDesc
+	ch <- e.libvirtHostDomainsMemoryMaximumDesc
+	ch <- e.libvirtHostMemoryHeadroomDesc
+	ch <- e.libvirtHostGraphicsPortsDesc
+	ch <- e.libvirtHostGraphicsPortConflictsDesc
+	ch <- e.libvirtHostGraphicsUnallocatedDesc
+	ch <- e.libvirtStoragePoolStateDesc
+	ch <- e.libvirtStoragePoolCapacityDesc
+	ch <- e.libvirtStoragePoolAllocationDesc
+	ch <- e.libvirtStoragePoolAvailableDesc
+	ch <- e.libvirtStorageVolCapacityDesc
+	ch <- e.libvirtStorageVolAllocationDesc
+	e.libvirtErrors.Describe(ch)
+	e.libvirtDomainScrapeErrors.Describe(ch)
+	ch <- e.libvirtDomainXMLParseFailedDesc
+	ch <- e.libvirtDomainXMLUnknownFieldsDesc
+	e.libvirtDomainCgroupFallbacks.Describe(ch)
+	ch <- e.libvirtDomainCgroupIOReadBytesDesc
+	ch <- e.libvirtDomainCgroupIOWriteBytesDesc
+	ch <- e.libvirtDomainCgroupIOReadReqsDesc
+	ch <- e.libvirtDomainCgroupIOWriteReqsDesc
+	ch <- e.libvirtDomainBlkioWeightDesc
+	ch <- e.libvirtDomainBlkioCgroupWeightDesc
+	ch <- e.libvirtDomainBlkioWeightMismatchDesc
+	ch <- e.libvirtDomainSecurityDenialsDesc
+	ch <- e.libvirtDomainLastBackupDesc
+
+	ch <- e.libvirtDomainInfoMaxMemDesc
+	ch <- e.libvirtDomainInfoMemoryDesc
+	ch <- e.libvirtDomainInfoNrVirtCpuDesc
+	ch <- e.libvirtDomainInfoCpuTimeDesc
+	ch <- e.libvirtDomainInfoCpuTimeNsDesc
+	ch <- e.libvirtDomainInfoIdDesc
+	ch <- e.libvirtDomainInfoDesc
+	ch <- e.libvirtDomainStateDesc
+	ch <- e.libvirtDomainOpenstackInfoDesc
+
+	ch <- e.libvirtDomainVcpuTimeDesc
+	ch <- e.libvirtDomainVcpuTimeNsDesc
+
+	ch <- e.libvirtDomainJobInfoDesc
+	ch <- e.libvirtDomainJobElapsedDesc
+	ch <- e.libvirtDomainJobRemainingDesc
+	ch <- e.libvirtDomainJobDowntimeDesc
+	ch <- e.libvirtDomainJobDataTotalDesc
+	ch <- e.libvirtDomainJobDataProcessedDesc
+	ch <- e.libvirtDomainJobDataRemainingDesc
+	ch <- e.libvirtDomainJobMemoryDirtyRateDesc
+	ch <- e.libvirtDomainJobMemoryIterationDesc
+
+	ch <- e.libvirtDomainTPMEmulatorUpDesc
+	ch <- e.libvirtDomainChannelConnectedDesc
+
+	ch <- e.libvirtDomainClockInfoDesc
+	ch <- e.libvirtDomainClockAdjustmentDesc
+	ch <- e.libvirtDomainClockTimerInfoDesc
+	ch <- e.libvirtDomainHyperVInfoDesc
+	ch <- e.libvirtDomainHyperVEnlightenmentDesc
+	ch <- e.libvirtDomainHyperVSpinlockRetriesDesc
+	ch <- e.libvirtDomainPlatformFeatureDesc
+	ch <- e.libvirtDomainNestedVirtualizationDesc
+	ch <- e.libvirtHostNestedVirtualizationDesc
+	ch <- e.libvirtDomainPendingRebootDesc
+	ch <- e.libvirtDomainCPUSocketsDesc
+	ch <- e.libvirtDomainCPUDiesDesc
+	ch <- e.libvirtDomainCPUCoresDesc
+	ch <- e.libvirtDomainCPUThreadsDesc
+	ch <- e.libvirtDomainDevicesDesc
+	ch <- e.libvirtDomainGraphicsInfoDesc
+
+	ch <- e.libvirtDomainCacheTuneSizeDesc
+	ch <- e.libvirtDomainShmemSizeDesc
+	ch <- e.libvirtDomainMemoryTuneBandwidthDesc
+
+	ch <- e.libvirtDomainMemoryStatsActualBalloonDesc
+	ch <- e.libvirtDomainMemoryStatsAvailableDesc
+	ch <- e.libvirtDomainMemoryStatsUnusedDesc
+	ch <- e.libvirtDomainMemoryStatsUsableDesc
+	ch <- e.libvirtDomainMemoryStatsRssDesc
+	ch <- e.libvirtDomainMemoryStatsDiskCachesDesc
+	ch <- e.libvirtDomainMemoryStatsSwapInDesc
+	ch <- e.libvirtDomainMemoryStatsSwapOutDesc
+	ch <- e.libvirtDomainMemoryStatsMajorFaultDesc
+	ch <- e.libvirtDomainMemoryStatsMinorFaultDesc
+
+	ch <- e.libvirtDomainBlockRdBytesDesc
+	ch <- e.libvirtDomainBlockRdReqDesc
+	ch <- e.libvirtDomainBlockRdTotalTimesDesc
+	ch <- e.libvirtDomainBlockWrBytesDesc
+	ch <- e.libvirtDomainBlockWrReqDesc
+	ch <- e.libvirtDomainBlockWrTotalTimesDesc
+	ch <- e.libvirtDomainBlockFlushReqDesc
+	ch <- e.libvirtDomainBlockFlushTotalTimesDesc
+	ch <- e.libvirtDomainBlockRdTotalTimesNsDesc
+	ch <- e.libvirtDomainBlockCapacityDesc
+	ch <- e.libvirtDomainBlockAllocationDesc
+	ch <- e.libvirtDomainBlockPhysicalSizeDesc
+	ch <- e.libvirtDomainBlockEncryptedDesc
+	ch <- e.libvirtDomainBlockInfoDesc
+	ch <- e.libvirtDomainBlockHostDeviceDesc
+	ch <- e.libvirtDomainBlockGuestDeviceDesc
+	ch <- e.libvirtDomainBlockMultipathPathsDesc
+	ch <- e.libvirtDomainBlockMultipathActivePathsDesc
+	ch <- e.libvirtDomainBlockIoTuneBytesDesc
+	ch <- e.libvirtDomainBlockIoTuneIopsDesc
+	ch <- e.libvirtDomainBlockIoTuneBurstBytesDesc
+	ch <- e.libvirtDomainBlockIoTuneBurstIopsDesc
+	ch <- e.libvirtDomainBlockWrTotalTimesNsDesc
+	ch <- e.libvirtDomainBlockFlushTotalTimesNsDesc
+
+	ch <- e.libvirtDomainInterfaceRxBytesDesc
+	ch <- e.libvirtDomainInterfaceRxPacketsDesc
+	ch <- e.libvirtDomainInterfaceRxErrsDesc
+	ch <- e.libvirtDomainInterfaceRxDropDesc
+	ch <- e.libvirtDomainInterfaceTxBytesDesc
+	ch <- e.libvirtDomainInterfaceTxPacketsDesc
+	ch <- e.libvirtDomainInterfaceTxErrsDesc
+	ch <- e.libvirtDomainInterfaceTxDropDesc
+	ch <- e.libvirtDomainInterfaceQueuesDesc
+	ch <- e.libvirtDomainInterfaceQueueLengthDesc
+	ch <- e.libvirtDomainInterfaceRxQueueDropsDesc
+	ch <- e.libvirtDomainInterfaceTxQueueDropsDesc
+	ch <- e.libvirtDomainInterfaceMTUDesc
+	ch <- e.libvirtDomainInterfaceTapMTUDesc
+	ch <- e.libvirtDomainInterfaceBridgeMTUDesc
+	ch <- e.libvirtDomainInterfaceMTUMismatchDesc
+	ch <- e.libvirtDomainInterfaceNWFilterRulesDesc
+}
+
+// Collect scrapes Prometheus metrics from libvirt.
+func (e *LibvirtExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collect(ch, true)
+}
+
+// unscrapedCollector collects the metrics of an exporter without counting
+// as a scrape.
+type unscrapedCollector struct {
+	e *LibvirtExporter
+}
+
+// Unscraped returns a collector of the metrics of the exporter that does
+// not count as a scrape of the exporter, leaving its heartbeat metrics
+// unchanged. It allows recording metrics in the background.
+func (e *LibvirtExporter) Unscraped() prometheus.Collector {
+	return unscrapedCollector{e: e}
+}
+
+// Describe implements prometheus.Collector.
+func (c unscrapedCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.e.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c unscrapedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.e.collect(ch, false)
+}
+
+// collect collects the metrics of the exporter, counting a scrape if
+// scrape is true.
+func (e *LibvirtExporter) collect(ch chan<- prometheus.Metric, scrape bool) {
+	// Heartbeat metrics are reported regardless of whether libvirt can
+	// be reached, so that a dead exporter can be told apart from a dead
+	// libvirt.
+	if scrape {
+		e.libvirtExporterScrapesTotal.Inc()
+		e.libvirtExporterLastScrapeTimestamp.SetToCurrentTime()
+	}
+	ch <- e.libvirtExporterScrapesTotal
+	ch <- e.libvirtExporterLastScrapeTimestamp
+	e.logger.Flush()
+
+	// Hosts wait for their turn before connecting to libvirt, but their
+	// heartbeat metrics are reported right away.
+	e.hostLimiter.acquire()
+	err := e.safely("libvirt", func() error {
+		return e.CollectFromLibvirt(ch)
+	})
+	e.hostLimiter.release()
+	switch {
+	case err == errNotCollectedYet:
+		// Until the domains collector has run once in the background,
+		// whether libvirt can be reached is unknown, so libvirt_up is
+		// not reported.
+		err = nil
+	case err == nil:
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtUpDesc,
+			prometheus.GaugeValue,
+			1.0)
+	default:
+		e.logger.Printf("Failed to scrape metrics: %s", err)
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtUpDesc,
+			prometheus.GaugeValue,
+			0.0)
+	}
+	e.collectErrMu.Lock()
+	e.collectErr = err
+	e.collectErrMu.Unlock()
+
+	// Host time is obtained from the kernel, not from libvirt, so it
+	// does not affect libvirt_up. It is the time of the host the
+	// exporter runs on, so it is only reported for local URIs.
+	if e.local {
+		if err := e.CollectHostTime(ch); err != nil {
+			e.logger.Printf("Failed to obtain host time: %s", err)
+		}
+	}
+	e.libvirtExporterPanicsRecovered.Collect(ch)
+	e.libvirtCollectorDuration.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtExporterInternedLabelsDesc,
+		prometheus.GaugeValue,
+		float64(e.labelValues.size()))
+	circuitOpen := 0.0
+	if e.breaker.isOpen() {
+		circuitOpen = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtExporterCircuitOpenDesc,
+		prometheus.GaugeValue,
+		circuitOpen)
+
+	maintenance := 0.0
+	if e.Maintenance() {
+		maintenance = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtHostMaintenanceDesc,
+		prometheus.GaugeValue,
+		maintenance)
+	ch <- infoMetric(
+		e.libvirtExporterConfigDesc,
+		e.configLabelValues...)
+
+	e.libvirtErrors.Collect(ch)
+	e.libvirtDomainScrapeErrors.Collect(ch)
+	e.libvirtDomainCgroupFallbacks.Collect(ch)
+	if e.watchEvents {
+		e.CollectDomainEvents(ch)
+	}
+}
+
+// URI returns the libvirt URI from which the exporter collects metrics.
+func (e *LibvirtExporter) URI() string {
+	return e.uri
+}
+
+// LastCollectError returns the error that caused the last collection from
+// libvirt to fail, or nil if it succeeded.
+func (e *LibvirtExporter) LastCollectError() error {
+	e.collectErrMu.Lock()
+	defer e.collectErrMu.Unlock()
+	return e.collectErr
+}
+
+// CollectFromLibvirt obtains Prometheus metrics from all domains in a
+// libvirt setup, running all collectors. Only the failure of the domains
+// collector is returned. Those of other collectors are logged, so that
+// hosts whose driver lacks some features still have their domains
+// reported. errNotCollectedYet is returned until the first run of the
+// domains collector completes if it runs in the background.
+func (e *LibvirtExporter) CollectFromLibvirt(ch chan<- prometheus.Metric) error {
+	var domainsErr error
+	for _, c := range e.collectors {
+		err := c.Collect(ch)
+		if c.name == "domains" {
+			domainsErr = err
+		} else if err != nil && err != errNotCollectedYet {
+			e.logger.Printf("Failed to collect %s metrics: %s", c.name, err)
+		}
+	}
+	return domainsErr
+}
+
+// connect returns a connection to libvirt from the pool. The caller must
+// call Close() on the connection once done with it. After repeated
+// failures, it fails right away until the circuit breaker closes.
+func (e *LibvirtExporter) connect() (*libvirt.Connect, error) {
+	if err := e.breaker.allow(); err != nil {
+		return nil, err
+	}
+	conn, err := e.pool.Get(e.uri)
+	e.breaker.record(err)
+	if err != nil {
+		e.countError("virConnectOpen", err)
+		return nil, err
+	}
+	e.setReady()
+	return conn, nil
+}
+
+// CollectHost obtains Prometheus metrics describing the host.
+func (e *LibvirtExporter) CollectHost(ch chan<- prometheus.Metric) error {
+	conn, err := e.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Not all drivers can report host hardware, which should not
+	// prevent other host metrics from being collected.
+	if err := e.CollectHostHardware(ch, conn); err != nil {
+		e.logger.Printf("Failed to obtain host hardware information: %s", err)
+	}
+	// Sensors and KVM parameters are read from the kernel of the host
+	// the exporter runs on, which is only the one of the domains for
+	// local URIs.
+	if e.local {
+		if err := e.CollectHostSensors(ch); err != nil {
+			e.logger.Printf("Failed to read host sensors: %s", err)
+		}
+		e.CollectHostNestedVirtualization(ch)
+	}
+	if err := e.CollectHostGraphics(ch, conn); err != nil {
+		e.logger.Printf("Failed to check graphics ports of domains: %s", err)
+	}
+	return e.CollectHostNode(ch, conn)
+}
+
+// CollectStorage obtains Prometheus metrics from the storage pools of the
+// host.
+func (e *LibvirtExporter) CollectStorage(ch chan<- prometheus.Metric) error {
+	conn, err := e.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return e.CollectStoragePools(ch, conn)
+}
+
+// CollectDomains obtains Prometheus metrics from all domains of the host.
+func (e *LibvirtExporter) CollectDomains(ch chan<- prometheus.Metric) error {
+	conn, err := e.connect()
+	if err != nil {
+		return &collectError{stage: "connect", err: err}
+	}
+	e.labelValues.rotate()
+	e.securityDenials.rotate()
+	defer conn.Close()
+
+	if err := e.CollectDomainCounts(ch, conn); err != nil {
+		return &collectError{stage: "list_domains", err: err}
+	}
+	if e.domainUUIDs != nil {
+		if err := e.domainUUIDs.Refresh(); err != nil {
+			e.logger.Printf("Failed to read domain UUID file, keeping previous UUIDs: %s", err)
+		}
+	}
+
+	// Obtain the statistics of all domains in bulk. This is much faster
+	// than querying every device of every domain individually, and copes
+	// with transient domains disappearing during the scrape.
+	// Statistics of disabled collectors are not requested at all.
+	statsTypes := libvirt.DOMAIN_STATS_STATE | libvirt.DOMAIN_STATS_CPU_TOTAL | libvirt.DOMAIN_STATS_BALLOON
+	if !e.disabled["vcpustats"] {
+		statsTypes |= libvirt.DOMAIN_STATS_VCPU
+	}
+	if !e.disabled["netstats"] {
+		statsTypes |= libvirt.DOMAIN_STATS_INTERFACE
+	}
+	if !e.disabled["blockstats"] {
+		statsTypes |= libvirt.DOMAIN_STATS_BLOCK
+	}
+	statsFlags := libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE
+	listFlags := libvirt.CONNECT_LIST_DOMAINS_ACTIVE
+	if e.includeInactive {
+		statsFlags |= libvirt.CONNECT_GET_ALL_DOMAINS_STATS_INACTIVE
+		listFlags |= libvirt.CONNECT_LIST_DOMAINS_INACTIVE
+	}
+	var counts domainCounts
+	allStats, err := conn.GetAllDomainStats(nil, statsTypes, statsFlags)
+	if err == nil {
+		defer func() {
+			for i := range allStats {
+				allStats[i].Domain.Free()
+			}
+		}()
+		e.forEachConcurrently(len(allStats), func(i int) {
+			e.collectDomainCounted(ch, &counts, allStats[i].Domain, &allStats[i])
+		})
+		e.reportScrapedDomains(ch, &counts)
+		return nil
+	}
+	e.countError("virConnectGetAllDomainStats", err)
+	if !isNoSupport(err) {
+		return &collectError{stage: "domain_stats", err: err}
+	}
+
+	// Fall back to querying domains individually.
+	doms, err := conn.ListAllDomains(listFlags)
+	if err != nil {
+		e.countError("virConnectListAllDomains", err)
+		return &collectError{stage: "list_domains", err: err}
+	}
+	e.forEachConcurrently(len(doms), func(i int) {
+		e.collectDomainCounted(ch, &counts, &doms[i], nil)
+		doms[i].Free()
+	})
+	e.reportScrapedDomains(ch, &counts)
+
+	return nil
+}
+
+// domainCounts counts the domains seen by a run of the domains collector,
+// by outcome. It is updated concurrently.
+type domainCounts struct {
+	collected int64
+	filtered  int64
+	failed    int64
+}
+
+// collectDomainCounted collects the metrics of a domain, recovering from
+// panics, reporting errors and counting the outcome in counts.
+func (e *LibvirtExporter) collectDomainCounted(ch chan<- prometheus.Metric, counts *domainCounts, domain *libvirt.Domain, stats *libvirt.DomainStats) {
+	selected := false
+	err := e.safely("domain", func() error {
+		var err error
+		selected, err = e.CollectDomain(ch, domain, stats)
+		return err
+	})
+	switch {
+	case err != nil:
+		e.reportDomainError(domain, err)
+		if !isNoDomain(err) {
+			atomic.AddInt64(&counts.failed, 1)
+		}
+	case selected:
+		atomic.AddInt64(&counts.collected, 1)
+	default:
+		atomic.AddInt64(&counts.filtered, 1)
+	}
+}
+
+// reportScrapedDomains reports the number of domains whose metrics were
+// collected and skipped, so that an exporter that silently stops finding
+// domains can be told apart from a host without domains.
+func (e *LibvirtExporter) reportScrapedDomains(ch chan<- prometheus.Metric, counts *domainCounts) {
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtScrapeDomainsDesc,
+		prometheus.GaugeValue,
+		float64(counts.collected))
+	for _, skipped := range []struct {
+		reason string
+		count  int64
+	}{
+		{"filtered", counts.filtered},
+		{"error", counts.failed},
+	} {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtScrapeSkippedDomainsDesc,
+			prometheus.GaugeValue,
+			float64(skipped.count),
+			skipped.reason)
+	}
+}
+
+// forEachConcurrently calls collect for every index from 0 to n-1, with at
+// most e.maxConcurrent calls running at once, and waits for all of them to
+// return. This keeps scrapes of hosts running hundreds of domains within
+// the scrape timeout, as most of the time spent collecting a domain is
+// waiting for libvirtd.
+func (e *LibvirtExporter) forEachConcurrently(n int, collect func(i int)) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, e.maxConcurrent)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			collect(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// countError counts an error returned by a libvirt API call, so that
+// recurring driver issues can be trended. Errors that do not originate
+// from libvirt are ignored.
+func (e *LibvirtExporter) countError(proc string, err error) {
+	if lverr, ok := err.(libvirt.Error); ok {
+		e.libvirtErrors.WithLabelValues(strconv.Itoa(int(lverr.Code)), proc).Inc()
+	}
+}
+
+// reportDomainError logs and counts an error that occurred while
+// collecting the metrics of a domain. Such errors are not fatal, so that a
+// single paused, migrating or broken domain does not hide the metrics of
+// all others. Domains that disappeared during the scrape are ignored.
+func (e *LibvirtExporter) reportDomainError(domain *libvirt.Domain, err error) {
+	if isNoDomain(err) {
+		return
+	}
+	domainName, _ := domain.GetName()
+	e.logger.Printf("Failed to collect metrics of domain %s: %s", domainName, err)
+	e.libvirtDomainScrapeErrors.WithLabelValues(domainName).Inc()
+}
+
+// domainLabelValues returns the values of the labels that are attached to
+// all metrics of a domain, in the order of e.domainLabels.
+func (e *LibvirtExporter) domainLabelValues(domainName string, desc *libvirt_schema.Domain) []string {
+	if e.exportNovaMetadata {
+		var (
+			novaName      = desc.Metadata.NovaInstance.Name
+			novaFlavor    = desc.Metadata.NovaInstance.Flavor.Name
+			novaUserId    = desc.Metadata.NovaInstance.Owner.User.UserId
+			novaProjectId = desc.Metadata.NovaInstance.Owner.Project.ProjectId
+		)
+		return keepLabelValues([]string{domainName, desc.UUID, novaName, novaFlavor, novaUserId, novaProjectId}, e.keptDomainLabels)
+	}
+	return keepLabelValues([]string{domainName, desc.UUID}, e.keptDomainLabels)
+}
+
+// CollectDomainOpenstackInfo reports the OpenStack Nova instance that a
+// domain belongs to. It is reported regardless of
+// --libvirt.export-nova-metadata, so that tenants can be joined on the
+// domain and resource_id labels without adding labels to every metric.
+func (e *LibvirtExporter) CollectDomainOpenstackInfo(ch chan<- prometheus.Metric, domainName string, desc *libvirt_schema.Domain) {
+	instance := &desc.Metadata.NovaInstance
+	if !instance.IsSet() {
+		return
+	}
+	ch <- infoMetric(
+		e.libvirtDomainOpenstackInfoDesc,
+		domainName,
+		desc.UUID,
+		instance.Name,
+		instance.Flavor.Name,
+		instance.Owner.Project.ProjectId,
+		strings.TrimSpace(instance.Owner.Project.ProjectName),
+		instance.Owner.User.UserId,
+		strings.TrimSpace(instance.Owner.User.UserName))
+}
+
+// blockSourceLabelValue returns the value of the source_file label of the
+// metrics of a block device, based on the disk attribute selected with
+// e.blockSourceLabel.
+func (e *LibvirtExporter) blockSourceLabelValue(disk *libvirt_schema.Disk) string {
+	switch e.blockSourceLabel {
+	case "dev":
+		return disk.Source.Dev
+	case "volume":
+		return disk.Source.Volume
+	case "source":
+		return disk.SourceName()
+	case "serial":
+		return disk.Serial
+	case "alias":
+		return disk.Alias.Name
+	default:
+		return disk.Source.File
+	}
+}
+
+// diskEncryptionMetric returns the libvirt_domain_block_encrypted metric
+// of a disk, which is 0 with an empty format label for disks that are not
+// encrypted, so that the coverage of encryption can be computed.
+func (e *LibvirtExporter) diskEncryptionMetric(domainLabelValues []string, disk *libvirt_schema.Disk) prometheus.Metric {
+	encrypted, format := 0.0, ""
+	if encryption := disk.GetEncryption(); encryption != nil {
+		encrypted, format = 1.0, encryption.Format
+	}
+	return prometheus.MustNewConstMetric(
+		e.libvirtDomainBlockEncryptedDesc,
+		prometheus.GaugeValue,
+		encrypted,
+		append(domainLabelValues, e.blockSourceLabelValue(disk), disk.Target.Device, format)...)
+}
+
+// diskInfoMetric returns the libvirt_domain_block_info metric of a disk,
+// which identifies the storage backing disks that have no source file,
+// such as network disks.
+func (e *LibvirtExporter) diskInfoMetric(domainLabelValues []string, disk *libvirt_schema.Disk) prometheus.Metric {
+	return infoMetric(
+		e.libvirtDomainBlockInfoDesc,
+		append(domainLabelValues, e.blockSourceLabelValue(disk), disk.Target.Device,
+			disk.SourceName(), disk.Type, disk.Driver.Type)...)
+}
+
+// CollectDomainCounts reports the number of domains on the host by state
+// and persistence. Active transient domains are domains that are running
+// without being defined, such as those leaked by an orchestrator that
+// crashed. Inactive domains are always persistent.
+func (e *LibvirtExporter) CollectDomainCounts(ch chan<- prometheus.Metric, conn *libvirt.Connect) error {
+	for _, set := range []struct {
+		state, persistence string
+		flags              libvirt.ConnectListAllDomainsFlags
+	}{
+		{"active", "persistent", libvirt.CONNECT_LIST_DOMAINS_ACTIVE | libvirt.CONNECT_LIST_DOMAINS_PERSISTENT},
+		{"active", "transient", libvirt.CONNECT_LIST_DOMAINS_ACTIVE | libvirt.CONNECT_LIST_DOMAINS_TRANSIENT},
+		{"inactive", "persistent", libvirt.CONNECT_LIST_DOMAINS_INACTIVE | libvirt.CONNECT_LIST_DOMAINS_PERSISTENT},
+	} {
+		doms, err := conn.ListAllDomains(set.flags)
+		if err != nil {
+			e.countError("virConnectListAllDomains", err)
+			return err
+		}
+		for _, domain := range doms {
+			(&domain).Free()
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtHostDomainsDesc,
+			prometheus.GaugeValue,
+			float64(len(doms)),
+			set.state,
+			set.persistence)
+	}
+	return nil
+}
+
+// CollectHostHardware reports the hardware of the host, based on its
+// sysinfo XML.
+func (e *LibvirtExporter) CollectHostHardware(ch chan<- prometheus.Metric, conn *libvirt.Connect) error {
+	sysinfoDesc, err := conn.GetSysinfo(0)
+	if err != nil {
+		e.countError("virConnectGetSysinfo", err)
+		return err
+	}
+	var sysinfo libvirt_schema.Sysinfo
+	err = xml.Unmarshal([]byte(sysinfoDesc), &sysinfo)
+	if err != nil {
+		return err
+	}
+
+	ch <- infoMetric(
+		e.libvirtHostHardwareInfoDesc,
+		sysinfo.System.Get("manufacturer"),
+		sysinfo.System.Get("product"),
+		sysinfo.System.Get("serial"),
+		sysinfo.BIOS.Get("version"))
+	return nil
+}
+
+// CollectDomain extracts Prometheus metrics from a libvirt domain. The
+// statistics of the domain are those returned by GetAllDomainStats(). If
+// they are not provided, for libvirt versions that lack
+// GetAllDomainStats(), they are assembled into a record of the same kind
+// from individual API calls before any metric is emitted, and are then
+// not sampled at the same instant. The state, CPU, vCPU, balloon, block
+// and interface statistics are all read from this record, so that values
+// sampled together by GetAllDomainStats(), such as the bytes and
+// requests of a block device, stay consistent with each other.
+//
+// Other metrics are sampled separately, at a different time than the
+// record: the progress of jobs, the I/O limits of disks, the disks seen
+// by the guest agent, network filters, checkpoints and the persistent
+// definition of the domain are queried from libvirt, while the cgroup
+// fallback, tap devices, the MTUs of tap devices and bridges, swtpm
+// processes and host block devices are read from the host.
+//
+// It returns whether the domain was selected by the domain filters.
+func (e *LibvirtExporter) CollectDomain(ch chan<- prometheus.Metric, domain *libvirt.Domain, stats *libvirt.DomainStats) (bool, error) {
+	domainName, err := domain.GetName()
+	if err != nil {
+		e.countError("virDomainGetName", err)
+		return false, err
+	}
+	if e.domainFilter != nil && !e.domainFilter.MatchString(domainName) {
+		return false, nil
+	}
+	if e.domainUUIDs != nil {
+		uuid, err := domain.GetUUIDString()
+		if err != nil {
+			e.countError("virDomainGetUUIDString", err)
+			return false, err
+		}
+		if !e.domainUUIDs.Contains(uuid) {
+			return false, nil
+		}
+	}
+
+	// Decode XML description of domain to get block device names, etc.
+	// Decoding is lenient: whatever could be extracted from a description
+	// that fails to parse is still used, and fields that are not
+	// understood are reported, so that missing metrics can be explained.
+	xmlDesc, err := domain.GetXMLDesc(0)
+	if err != nil {
+		e.countError("virDomainGetXMLDesc", err)
+		return false, err
+	}
+	var desc libvirt_schema.Domain
+	parseFailed := 0.0
+	if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+		e.logger.Printf("Failed to fully parse XML description of domain %s: %s", domainName, err)
+		parseFailed = 1
+	}
+	domainName = e.labelValues.intern(domainName)
+	e.labelValues.internDomain(&desc)
+	domainLabelValues := e.domainLabelValues(domainName, &desc)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtDomainXMLParseFailedDesc,
+		prometheus.GaugeValue,
+		parseFailed,
+		domainLabelValues...)
+	e.CollectDomainXMLUnknownFields(ch, domainLabelValues, &desc)
+
+	if stats == nil {
+		stats, err = e.legacyDomainStats(domain, domainName, &desc)
+		if err != nil {
+			return false, err
+		}
+	}
+	running := stats.State != nil && stats.State.State != libvirt.DOMAIN_SHUTOFF
+
+	// Report domain info.
+	ch <- infoMetric(
+		e.libvirtDomainInfoDesc,
+		append(domainLabelValues, desc.Type, desc.OS.Type.Type, desc.OS.Type.Arch, desc.OS.Type.Machine)...)
+	e.CollectDomainOpenstackInfo(ch, domainName, &desc)
+	if changed, ok := e.domainEvents.changedAt(desc.UUID); ok {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainConfigChangedTimeDesc,
+			prometheus.GaugeValue,
+			float64(changed.UnixNano())/1e9,
+			domainLabelValues...)
+	}
+	if stats.State != nil && stats.State.StateSet {
+		for _, state := range domainStates {
+			value := 0.0
+			if stats.State.State == state.state {
+				value = 1.0
+			}
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainStateDesc,
+				prometheus.GaugeValue,
+				value,
+				append(domainLabelValues, state.name)...)
+		}
+	}
+	if stats.Balloon != nil && stats.Balloon.MaximumSet {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInfoMaxMemDesc,
+			prometheus.GaugeValue,
+			float64(stats.Balloon.Maximum)*1024,
+			domainLabelValues...)
+	}
+	if stats.Balloon != nil && stats.Balloon.CurrentSet {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInfoMemoryDesc,
+			prometheus.GaugeValue,
+			float64(stats.Balloon.Current)*1024,
+			domainLabelValues...)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtDomainInfoNrVirtCpuDesc,
+		prometheus.GaugeValue,
+		float64(desc.Vcpu.CurrentCount()),
+		domainLabelValues...)
+	if e.cgroupFallback && e.local && running {
+		e.collectCgroupFallback(ch, domainName, domainLabelValues, stats, len(desc.Devices.Disks) > 0)
+	}
+	if stats.Cpu != nil && stats.Cpu.TimeSet {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInfoCpuTimeDesc,
+			prometheus.CounterValue,
+			float64(stats.Cpu.Time)/1e9,
+			domainLabelValues...)
+		if e.exportNanoseconds {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInfoCpuTimeNsDesc,
+				prometheus.CounterValue,
+				float64(stats.Cpu.Time),
+				domainLabelValues...)
+		}
+	}
+
+	// Domains only have an identifier while they are running.
+	if running {
+		id, err := domain.GetID()
+		if err != nil {
+			e.countError("virDomainGetID", err)
+			return false, err
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInfoIdDesc,
+			prometheus.GaugeValue,
+			float64(id),
+			domainLabelValues...)
+		// swtpm runs on the host of the domain, so its state can only
+		// be checked for local URIs.
+		if e.local {
+			e.CollectDomainTPM(ch, id, domainLabelValues, &desc)
+		}
+		if !e.disabled["jobstats"] {
+			e.CollectDomainJob(ch, domain, domainName, domainLabelValues)
+		}
+	}
+
+	// Report whether the guest side of channels is connected, which
+	// tells whether the guest agent can be queried.
+	for _, channel := range desc.Devices.Channels {
+		if channel.Target.State == "" {
+			continue
+		}
+		connected := 0.0
+		if channel.Target.State == "connected" {
+			connected = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainChannelConnectedDesc,
+			prometheus.GaugeValue,
+			connected,
+			append(domainLabelValues, channel.Target.Name)...)
+	}
+
+	// Report per virtual CPU statistics.
+	for number, vcpu := range stats.Vcpu {
+		if !vcpu.TimeSet {
+			continue
+		}
+		vcpuLabelValues := append(domainLabelValues, strconv.Itoa(number))
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainVcpuTimeDesc,
+			prometheus.CounterValue,
+			float64(vcpu.Time)/1e9,
+			vcpuLabelValues...)
+		if e.exportNanoseconds {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainVcpuTimeNsDesc,
+				prometheus.CounterValue,
+				float64(vcpu.Time),
+				vcpuLabelValues...)
+		}
+	}
+
+	e.CollectDomainClock(ch, domainLabelValues, &desc)
+	e.CollectDomainHyperV(ch, domainLabelValues, &desc)
+	e.CollectDomainPlatformFeatures(ch, domainLabelValues, &desc)
+	e.CollectDomainNestedVirtualization(ch, domainLabelValues, &desc)
+	e.CollectDomainCPUTopology(ch, domainLabelValues, &desc)
+	e.CollectDomainDevices(ch, domainLabelValues, &desc)
+	e.CollectDomainGraphics(ch, domainLabelValues, &desc)
+	e.CollectDomainResctrl(ch, domainName, domainLabelValues, &desc)
+	e.CollectDomainShmem(ch, domainName, domainLabelValues, &desc)
+	e.CollectDomainBlkioWeight(ch, domainName, domainLabelValues, &desc, running)
+	if e.securityDenials != nil {
+		e.CollectDomainSecurityDenials(ch, domainLabelValues, &desc)
+	}
+	e.CollectDomainLastBackup(ch, domain, domainName, domainLabelValues, &desc)
+	if e.pendingReboot && running {
+		e.CollectDomainPendingReboot(ch, domain, domainName, domainLabelValues, &desc)
+	}
+	if e.exportGuestDisks && running {
+		e.CollectDomainGuestDisks(ch, domain, domainName, domainLabelValues, &desc)
+	}
+
+	// Report memory statistics. Each statistic is only emitted when it
+	// is reported by the hypervisor. Sizes are reported by libvirt in KiB.
+	if balloon := stats.Balloon; balloon != nil && running && !e.disabled["memorystats"] {
+		if balloon.CurrentSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsActualBalloonDesc,
+				prometheus.GaugeValue,
+				float64(balloon.Current)*1024,
+				domainLabelValues...)
+		}
+		if balloon.AvailableSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsAvailableDesc,
+				prometheus.GaugeValue,
+				float64(balloon.Available)*1024,
+				domainLabelValues...)
+		}
+		if balloon.UnusedSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsUnusedDesc,
+				prometheus.GaugeValue,
+				float64(balloon.Unused)*1024,
+				domainLabelValues...)
+		}
+		if balloon.UsableSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsUsableDesc,
+				prometheus.GaugeValue,
+				float64(balloon.Usable)*1024,
+				domainLabelValues...)
+		}
+		if balloon.RssSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsRssDesc,
+				prometheus.GaugeValue,
+				float64(balloon.Rss)*1024,
+				domainLabelValues...)
+		}
+		if balloon.DiskCachesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsDiskCachesDesc,
+				prometheus.GaugeValue,
+				float64(balloon.DiskCaches)*1024,
+				domainLabelValues...)
+		}
+		if balloon.SwapInSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsSwapInDesc,
+				prometheus.CounterValue,
+				float64(balloon.SwapIn)*1024,
+				domainLabelValues...)
+		}
+		if balloon.SwapOutSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsSwapOutDesc,
+				prometheus.CounterValue,
+				float64(balloon.SwapOut)*1024,
+				domainLabelValues...)
+		}
+		if balloon.MajorFaultSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsMajorFaultDesc,
+				prometheus.CounterValue,
+				float64(balloon.MajorFault),
+				domainLabelValues...)
+		}
+		if balloon.MinorFaultSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryStatsMinorFaultDesc,
+				prometheus.CounterValue,
+				float64(balloon.MinorFault),
+				domainLabelValues...)
+		}
+	}
+
+	// Report the source and encryption of disks, which are part of
+	// their configuration and thus reported for inactive domains as well.
+	for _, disk := range desc.Devices.Disks {
+		if disk.Device == "cdrom" || disk.Device == "fd" {
+			continue
+		}
+		ch <- e.diskInfoMetric(domainLabelValues, &disk)
+		ch <- e.diskEncryptionMetric(domainLabelValues, &disk)
+		if e.resolveHostDevices && e.local {
+			e.CollectDiskHostDevice(ch, domainName, domainLabelValues, &disk)
+		}
+	}
+
+	// Report block device statistics.
+	for _, disk := range desc.Devices.Disks {
+		if disk.Device == "cdrom" || disk.Device == "fd" {
+			continue
+		}
+		blockStats := findBlockStats(stats, disk.Target.Device)
+		if blockStats == nil {
+			continue
+		}
+		blockLabelValues := append(domainLabelValues, e.blockSourceLabelValue(&disk), disk.Target.Device)
+
+		if blockStats.RdBytesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockRdBytesDesc,
+				prometheus.CounterValue,
+				float64(blockStats.RdBytes),
+				blockLabelValues...)
+		}
+		if blockStats.RdReqsSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockRdReqDesc,
+				prometheus.CounterValue,
+				float64(blockStats.RdReqs),
+				blockLabelValues...)
+		}
+		if blockStats.RdTimesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockRdTotalTimesDesc,
+				prometheus.CounterValue,
+				float64(blockStats.RdTimes)/1e9,
+				blockLabelValues...)
+			if e.exportNanoseconds {
+				ch <- prometheus.MustNewConstMetric(
+					e.libvirtDomainBlockRdTotalTimesNsDesc,
+					prometheus.CounterValue,
+					float64(blockStats.RdTimes),
+					blockLabelValues...)
+			}
+		}
+		if blockStats.WrBytesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockWrBytesDesc,
+				prometheus.CounterValue,
+				float64(blockStats.WrBytes),
+				blockLabelValues...)
+		}
+		if blockStats.WrReqsSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockWrReqDesc,
+				prometheus.CounterValue,
+				float64(blockStats.WrReqs),
+				blockLabelValues...)
+		}
+		if blockStats.WrTimesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockWrTotalTimesDesc,
+				prometheus.CounterValue,
+				float64(blockStats.WrTimes)/1e9,
+				blockLabelValues...)
+			if e.exportNanoseconds {
+				ch <- prometheus.MustNewConstMetric(
+					e.libvirtDomainBlockWrTotalTimesNsDesc,
+					prometheus.CounterValue,
+					float64(blockStats.WrTimes),
+					blockLabelValues...)
+			}
+		}
+		if blockStats.FlReqsSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockFlushReqDesc,
+				prometheus.CounterValue,
+				float64(blockStats.FlReqs),
+				blockLabelValues...)
+		}
+		if blockStats.FlTimesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockFlushTotalTimesDesc,
+				prometheus.CounterValue,
+				float64(blockStats.FlTimes)/1e9,
+				blockLabelValues...)
+			if e.exportNanoseconds {
+				ch <- prometheus.MustNewConstMetric(
+					e.libvirtDomainBlockFlushTotalTimesNsDesc,
+					prometheus.CounterValue,
+					float64(blockStats.FlTimes),
+					blockLabelValues...)
+			}
+		}
+		// Skip "Errors", as the documentation does not clearly
+		// explain what this means.
+
+		if blockStats.CapacitySet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockCapacityDesc,
+				prometheus.GaugeValue,
+				float64(blockStats.Capacity),
+				blockLabelValues...)
+		}
+		if blockStats.AllocationSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockAllocationDesc,
+				prometheus.GaugeValue,
+				float64(blockStats.Allocation),
+				blockLabelValues...)
+		}
+		if blockStats.PhysicalSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainBlockPhysicalSizeDesc,
+				prometheus.GaugeValue,
+				float64(blockStats.Physical),
+				blockLabelValues...)
+		}
+	}
+
+	// Report network interface statistics.
+	for _, iface := range desc.Devices.Interfaces {
+		if iface.Target.Device == "" {
+			continue
+		}
+		interfaceStats := findNetStats(stats, iface.Target.Device)
+		if interfaceStats == nil {
+			continue
+		}
+		interfaceLabelValues := append(domainLabelValues, iface.Source.Bridge, iface.Target.Device)
+
+		if interfaceStats.RxBytesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceRxBytesDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.RxBytes),
+				interfaceLabelValues...)
+		}
+		if interfaceStats.RxPktsSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceRxPacketsDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.RxPkts),
+				interfaceLabelValues...)
+		}
+		if interfaceStats.RxErrsSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceRxErrsDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.RxErrs),
+				interfaceLabelValues...)
+		}
+		if interfaceStats.RxDropSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceRxDropDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.RxDrop),
+				interfaceLabelValues...)
+		}
+		if interfaceStats.TxBytesSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceTxBytesDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.TxBytes),
+				interfaceLabelValues...)
+		}
+		if interfaceStats.TxPktsSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceTxPacketsDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.TxPkts),
+				interfaceLabelValues...)
+		}
+		if interfaceStats.TxErrsSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceTxErrsDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.TxErrs),
+				interfaceLabelValues...)
+		}
+		if interfaceStats.TxDropSet {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainInterfaceTxDropDesc,
+				prometheus.CounterValue,
+				float64(interfaceStats.TxDrop),
+				interfaceLabelValues...)
+		}
+	}
+	if e.local && !e.disabled["netstats"] {
+		e.CollectDomainTapQueues(ch, domainLabelValues, &desc)
+	}
+	e.CollectDomainInterfaceMTU(ch, domainLabelValues, &desc, e.local && running)
+	if e.exportBlockIoTune && running {
+		e.CollectDomainBlockIoTune(ch, domain, domainName, domainLabelValues, &desc)
+	}
+	if e.exportNWFilters && running {
+		e.CollectDomainNWFilters(ch, domain, domainName, domainLabelValues, &desc)
+	}
+
+	return true, nil
+}
+
+// maxStartupBackoff caps the delay between connection attempts at startup.
+const maxStartupBackoff = time.Minute
+
+// WaitForLibvirt tries to connect to libvirt, retrying with exponential
+// backoff, until a connection succeeds or the number of retries is
+// exhausted.
+func WaitForLibvirt(uri string, retries int, backoff time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		conn, err := libvirt.NewConnect(uri)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if attempt >= retries {
+			return err
+		}
+		log.Printf("Failed to connect to libvirt, retrying in %s: %s", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxStartupBackoff {
+			backoff = maxStartupBackoff
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ThrottledLogger logs messages, suppressing identical messages that are
+// repeated within a given interval. This prevents a single broken domain
+// from emitting the same error on every scrape.
+type ThrottledLogger struct {
+	interval   time.Duration
+	suppressed prometheus.Counter
+
+	mu      sync.Mutex
+	entries map[string]*throttledLogEntry
+}
+
+type throttledLogEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+// NewThrottledLogger returns a logger suppressing identical messages
+// repeated within interval, or logging all messages if interval is not
+// positive.
+func NewThrottledLogger(interval time.Duration) *ThrottledLogger {
+	return &ThrottledLogger{
+		interval: interval,
+		suppressed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "libvirt_exporter",
+				Name:      "log_messages_suppressed_total",
+				Help:      "Number of log messages that were suppressed, as they were identical to a recently logged message.",
+			}),
+		entries: map[string]*throttledLogEntry{},
+	}
+}
+
+// Printf logs a message, unless an identical message was logged less
+// than the throttling interval ago.
+func (l *ThrottledLogger) Printf(format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	if l.interval <= 0 {
+		log.Print(message)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	entry, ok := l.entries[message]
+	if !ok {
+		l.entries[message] = &throttledLogEntry{logged: now}
+		log.Print(message)
+		return
+	}
+	if now.Sub(entry.logged) < l.interval {
+		entry.suppressed++
+		l.suppressed.Inc()
+		return
+	}
+	if entry.suppressed > 0 {
+		log.Printf("%s (%d identical messages suppressed)", message, entry.suppressed)
+	} else {
+		log.Print(message)
+	}
+	entry.logged = now
+	entry.suppressed = 0
+}
+
+// Flush summarizes the messages that were suppressed during throttling
+// intervals that have elapsed, and forgets about them.
+func (l *ThrottledLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for message, entry := range l.entries {
+		if now.Sub(entry.logged) < l.interval {
+			continue
+		}
+		if entry.suppressed > 0 {
+			log.Printf("%d identical messages suppressed in the last %s: %s", entry.suppressed, now.Sub(entry.logged).Round(time.Second), message)
+		}
+		delete(l.entries, message)
+	}
+}
+
+// Describe returns metadata for the metrics of the logger.
+func (l *ThrottledLogger) Describe(ch chan<- *prometheus.Desc) {
+	l.suppressed.Describe(ch)
+}
+
+// Collect reports the number of suppressed messages.
+func (l *ThrottledLogger) Collect(ch chan<- prometheus.Metric) {
+	l.suppressed.Collect(ch)
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// kvmModuleDir holds the parameters of the loaded kernel modules.
+const kvmModuleDir = "/sys/module"
+
+// kvmModules are the KVM modules of the host that support nested
+// virtualization, on x86 and POWER hosts.
+var kvmModules = []string{"kvm_intel", "kvm_amd", "kvm_hv"}
+
+// cpuMode returns the mode of the virtual CPU of a domain, which defaults
+// to custom.
+func cpuMode(cpu *libvirt_schema.CPU) string {
+	if cpu.Mode == "" {
+		return "custom"
+	}
+	return cpu.Mode
+}
+
+// exposesNestedVirtualization returns whether the virtual CPU of a domain
+// exposes the hardware virtualization extensions of x86 CPUs to the
+// guest. They are exposed if the vmx or svm feature is added explicitly,
+// or by the host-passthrough, host-model and maximum modes, which inherit
+// them from the host unless the feature is disabled.
+func exposesNestedVirtualization(cpu *libvirt_schema.CPU) bool {
+	for _, feature := range cpu.Features {
+		if feature.Name != "vmx" && feature.Name != "svm" {
+			continue
+		}
+		switch feature.Policy {
+		case "disable", "forbid":
+			return false
+		default:
+			return true
+		}
+	}
+	switch cpu.Mode {
+	case "host-passthrough", "host-model", "maximum":
+		return true
+	}
+	return false
+}
+
+// enablesNestedHV returns whether the nested-hv feature of ppc64 domains,
+// which lets pseries guests run their own virtual machines, is enabled.
+func enablesNestedHV(features *libvirt_schema.Features) bool {
+	for _, feature := range features.Others {
+		if feature.XMLName.Local == "nested-hv" {
+			return feature.State == "on"
+		}
+	}
+	return false
+}
+
+// CollectDomainNestedVirtualization reports whether a domain can run its
+// own virtual machines, based on the configuration of its virtual CPU or,
+// on ppc64, of its nested-hv feature, so that a policy forbidding nested
+// virtualization can be enforced through alerts. Whether the guest can
+// actually use it also depends on the host, as reported by
+// libvirt_host_nested_virtualization. Nothing is reported for other
+// architectures.
+func (e *LibvirtExporter) CollectDomainNestedVirtualization(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	value := 0.0
+	switch desc.OS.Type.Arch {
+	case "", "x86_64", "i686":
+		if exposesNestedVirtualization(&desc.CPU) {
+			value = 1.0
+		}
+	case "ppc64", "ppc64le":
+		if enablesNestedHV(&desc.Features) {
+			value = 1.0
+		}
+	default:
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtDomainNestedVirtualizationDesc,
+		prometheus.GaugeValue,
+		value,
+		append(domainLabelValues, cpuMode(&desc.CPU))...)
+}
+
+// CollectHostNestedVirtualization reports whether nested virtualization is
+// enabled in the KVM modules loaded on the host, from their nested
+// parameter, which is Y or 1 when enabled. Nothing is reported for
+// modules that are not loaded.
+func (e *LibvirtExporter) CollectHostNestedVirtualization(ch chan<- prometheus.Metric) {
+	for _, module := range kvmModules {
+		data, err := ioutil.ReadFile(filepath.Join(kvmModuleDir, module, "parameters", "nested"))
+		if err != nil {
+			continue
+		}
+		value := 0.0
+		switch strings.TrimSpace(string(data)) {
+		case "Y", "1":
+			value = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtHostNestedVirtualizationDesc,
+			prometheus.GaugeValue,
+			value,
+			module)
+	}
+}
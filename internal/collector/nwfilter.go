@@ -0,0 +1,92 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainNWFilters reports the number of rules of the network
+// filters applied to the interfaces of a running domain. Filters with
+// many rules, e.g. through deep chains of referenced filters, slow down
+// every packet of the interface.
+func (e *LibvirtExporter) CollectDomainNWFilters(ch chan<- prometheus.Metric, domain *libvirt.Domain, domainName string, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	var conn *libvirt.Connect
+	for _, iface := range desc.Devices.Interfaces {
+		if iface.FilterRef == nil || iface.Target.Device == "" {
+			continue
+		}
+		if conn == nil {
+			var err error
+			conn, err = domain.DomainGetConnect()
+			if err != nil {
+				e.logger.Printf("Failed to get connection of domain %s: %s", domainName, err)
+				return
+			}
+			defer conn.Close()
+		}
+		rules, err := e.countNWFilterRules(conn, iface.FilterRef.Filter, map[string]bool{})
+		if err != nil {
+			e.logger.Printf("Failed to count network filter rules of domain %s: %s", domainName, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInterfaceNWFilterRulesDesc,
+			prometheus.GaugeValue,
+			float64(rules),
+			append(domainLabelValues, iface.Source.Bridge, iface.Target.Device, iface.FilterRef.Filter)...)
+	}
+}
+
+// countNWFilterRules returns the number of rules of a network filter and
+// of the filters it references. Filters that were already seen are
+// skipped, which also protects against reference loops.
+func (e *LibvirtExporter) countNWFilterRules(conn *libvirt.Connect, name string, seen map[string]bool) (int, error) {
+	if seen[name] {
+		return 0, nil
+	}
+	seen[name] = true
+
+	filter, err := conn.LookupNWFilterByName(name)
+	if err != nil {
+		e.countError("virNWFilterLookupByName", err)
+		return 0, fmt.Errorf("failed to look up filter %s: %s", name, err)
+	}
+	defer filter.Free()
+	xmlDesc, err := filter.GetXMLDesc(0)
+	if err != nil {
+		e.countError("virNWFilterGetXMLDesc", err)
+		return 0, err
+	}
+	var desc libvirt_schema.NWFilter
+	if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+		return 0, fmt.Errorf("failed to parse filter %s: %s", name, err)
+	}
+
+	rules := len(desc.Rules)
+	for _, ref := range desc.FilterRefs {
+		n, err := e.countNWFilterRules(conn, ref.Filter, seen)
+		if err != nil {
+			return 0, err
+		}
+		rules += n
+	}
+	return rules, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// rebootChanges are the changes to the persistent configuration of a
+// domain that only take effect once it is restarted, detected by
+// comparing it with the live configuration.
+var rebootChanges = []struct {
+	name    string
+	differs func(live, config *libvirt_schema.Domain) bool
+}{
+	{"machine", func(live, config *libvirt_schema.Domain) bool {
+		return live.OS.Type.Machine != config.OS.Type.Machine
+	}},
+	{"cpu", func(live, config *libvirt_schema.Domain) bool {
+		// The live configuration of domains in host-model mode holds
+		// the custom model of the host CPU it was expanded to, which
+		// cannot be compared with the persistent configuration.
+		if config.CPU.Mode == "host-model" {
+			return live.CPU.Mode == "host-passthrough" || live.CPU.Mode == "maximum"
+		}
+		return cpuMode(&live.CPU) != cpuMode(&config.CPU) || live.CPU.Model != config.CPU.Model
+	}},
+	{"vcpus", func(live, config *libvirt_schema.Domain) bool {
+		return live.Vcpu.Count != config.Vcpu.Count
+	}},
+}
+
+// CollectDomainPendingReboot reports the changes to the persistent
+// configuration of a running domain that are waiting for it to be
+// restarted, such as an upgrade of its machine type or a change of its
+// CPU model, so that maintenance windows can be planned for them.
+// Transient domains have no persistent configuration and are skipped.
+func (e *LibvirtExporter) CollectDomainPendingReboot(ch chan<- prometheus.Metric, domain *libvirt.Domain, domainName string, domainLabelValues []string, live *libvirt_schema.Domain) {
+	persistent, err := domain.IsPersistent()
+	if err != nil {
+		e.countError("virDomainIsPersistent", err)
+		return
+	}
+	if !persistent {
+		return
+	}
+	xmlDesc, err := domain.GetXMLDesc(libvirt.DOMAIN_XML_INACTIVE)
+	if err != nil {
+		e.countError("virDomainGetXMLDesc", err)
+		return
+	}
+	var config libvirt_schema.Domain
+	if err := xml.Unmarshal([]byte(xmlDesc), &config); err != nil {
+		e.logger.Printf("Failed to parse persistent configuration of domain %s: %s", domainName, err)
+		return
+	}
+	for _, change := range rebootChanges {
+		value := 0.0
+		if change.differs(live, &config) {
+			value = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainPendingRebootDesc,
+			prometheus.GaugeValue,
+			value,
+			append(domainLabelValues, change.name)...)
+	}
+}
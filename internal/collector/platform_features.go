@@ -0,0 +1,61 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// platformFeatureSetting returns the setting of a feature specific to the
+// aarch64 or ppc64 architectures, and false for other features.
+func platformFeatureSetting(feature *libvirt_schema.Feature) (string, bool) {
+	switch feature.XMLName.Local {
+	// aarch64
+	case "gic":
+		return feature.Version, true
+	case "ras":
+		return feature.State, true
+	// ppc64
+	case "htm", "nested-hv", "ccf-assist":
+		return feature.State, true
+	case "cfpc", "sbbc", "ibs":
+		return feature.Value, true
+	case "hpt":
+		return feature.Resizing, true
+	}
+	return "", false
+}
+
+// CollectDomainPlatformFeatures reports the features of a domain that are
+// specific to the aarch64 and ppc64 architectures, such as the version of
+// its interrupt controller (GIC) on aarch64, or hardware transactional
+// memory (HTM) and the mitigations of speculative execution (cfpc, sbbc
+// and ibs) of pseries guests on ppc64, so that fleets of ARM and POWER
+// hosts get configuration metrics comparable to those of x86 hosts.
+// Settings that are not set, and left to the hypervisor, are reported
+// empty.
+func (e *LibvirtExporter) CollectDomainPlatformFeatures(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for i := range desc.Features.Others {
+		feature := &desc.Features.Others[i]
+		setting, ok := platformFeatureSetting(feature)
+		if !ok {
+			continue
+		}
+		ch <- infoMetric(
+			e.libvirtDomainPlatformFeatureDesc,
+			append(domainLabelValues, feature.XMLName.Local, setting)...)
+	}
+}
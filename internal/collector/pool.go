@@ -0,0 +1,178 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConnPool keeps connections to libvirt open across scrapes, instead of
+// connecting on every scrape, which is costly for remote hosts. At most
+// one connection is kept per URI, and at most maxSize connections are
+// kept overall, the least recently used one being evicted first.
+// Connections that are no longer alive are evicted when requested.
+type ConnPool struct {
+	maxSize int
+
+	mu    sync.Mutex
+	conns map[string]*pooledConn
+
+	libvirtExporterPoolConnectionsDesc *prometheus.Desc
+	libvirtExporterPoolOpened          prometheus.Counter
+	libvirtExporterPoolEvicted         *prometheus.CounterVec
+}
+
+type pooledConn struct {
+	conn     *libvirt.Connect
+	lastUsed time.Time
+}
+
+// NewConnPool returns a pool keeping at most maxSize connections open, or
+// none if maxSize is not positive, in which case every connection is
+// opened on request and closed by its caller.
+func NewConnPool(maxSize int) *ConnPool {
+	return &ConnPool{
+		maxSize: maxSize,
+		conns:   map[string]*pooledConn{},
+		libvirtExporterPoolConnectionsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("libvirt_exporter", "pool", "connections"),
+			"Number of connections to libvirt kept open by the exporter.",
+			nil,
+			nil),
+		libvirtExporterPoolOpened: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "libvirt_exporter",
+				Subsystem: "pool",
+				Name:      "connections_opened_total",
+				Help:      "Number of connections to libvirt opened by the exporter.",
+			}),
+		libvirtExporterPoolEvicted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "libvirt_exporter",
+				Subsystem: "pool",
+				Name:      "connections_evicted_total",
+				Help:      "Number of connections to libvirt closed by the exporter, by reason (dead or capacity).",
+			},
+			[]string{"reason"}),
+	}
+}
+
+// Get returns a connection to the given URI, opening it if needed. The
+// caller must call Close() on the connection once done with it.
+func (p *ConnPool) Get(uri string) (*libvirt.Connect, error) {
+	if conn, err := p.getPooled(uri); conn != nil || err != nil {
+		return conn, err
+	}
+
+	// The lock is not held while connecting, so that a host that does
+	// not respond does not delay connecting to the other hosts.
+	conn, err := libvirt.NewConnect(uri)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.libvirtExporterPoolOpened.Inc()
+	if _, ok := p.conns[uri]; ok || p.maxSize <= 0 {
+		// Pooling is disabled, or another connection to the URI was
+		// pooled in the meantime: the connection is closed by the
+		// caller.
+		return conn, nil
+	}
+	for len(p.conns) >= p.maxSize {
+		p.evictLocked(p.leastRecentlyUsedLocked(), "capacity")
+	}
+	// The pool holds a reference of its own, released upon eviction.
+	if err := conn.Ref(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	p.conns[uri] = &pooledConn{conn: conn, lastUsed: time.Now()}
+	return conn, nil
+}
+
+// getPooled returns the pooled connection to the given URI, or nil if
+// there is none that is alive.
+func (p *ConnPool) getPooled(uri string) (*libvirt.Connect, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pooled, ok := p.conns[uri]
+	if !ok {
+		return nil, nil
+	}
+	if alive, err := pooled.conn.IsAlive(); err == nil && alive {
+		if err := pooled.conn.Ref(); err != nil {
+			return nil, err
+		}
+		pooled.lastUsed = time.Now()
+		return pooled.conn, nil
+	}
+	p.evictLocked(uri, "dead")
+	return nil, nil
+}
+
+func (p *ConnPool) leastRecentlyUsedLocked() string {
+	var oldestURI string
+	var oldest time.Time
+	for uri, pooled := range p.conns {
+		if oldestURI == "" || pooled.lastUsed.Before(oldest) {
+			oldestURI, oldest = uri, pooled.lastUsed
+		}
+	}
+	return oldestURI
+}
+
+func (p *ConnPool) evictLocked(uri string, reason string) {
+	if pooled, ok := p.conns[uri]; ok {
+		pooled.conn.Close()
+		delete(p.conns, uri)
+		p.libvirtExporterPoolEvicted.WithLabelValues(reason).Inc()
+	}
+}
+
+// Close closes all connections kept by the pool. Connections that are in
+// use are closed once their last user releases them.
+func (p *ConnPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for uri, pooled := range p.conns {
+		pooled.conn.Close()
+		delete(p.conns, uri)
+	}
+}
+
+// Describe returns metadata for the metrics of the pool.
+func (p *ConnPool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.libvirtExporterPoolConnectionsDesc
+	p.libvirtExporterPoolOpened.Describe(ch)
+	p.libvirtExporterPoolEvicted.Describe(ch)
+}
+
+// Collect reports the usage of the pool.
+func (p *ConnPool) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	size := len(p.conns)
+	p.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(
+		p.libvirtExporterPoolConnectionsDesc,
+		prometheus.GaugeValue,
+		float64(size))
+	p.libvirtExporterPoolOpened.Collect(ch)
+	p.libvirtExporterPoolEvicted.Collect(ch)
+}
@@ -0,0 +1,211 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// previewCollector emits the metrics that would be exported for a domain,
+// based on its XML description only. As no hypervisor is queried, all
+// values are reported as zero, except for those of metrics that are
+// derived from the XML description itself.
+type previewCollector struct {
+	exporter *LibvirtExporter
+	desc     *libvirt_schema.Domain
+}
+
+// Describe is left empty, which makes previewCollector an unchecked
+// collector.
+func (c *previewCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect emits a metric for every series that would be exported for the
+// domain.
+func (c *previewCollector) Collect(ch chan<- prometheus.Metric) {
+	e := c.exporter
+	domainLabelValues := e.domainLabelValues(c.desc.Name, c.desc)
+
+	for _, desc := range []*prometheus.Desc{
+		e.libvirtDomainInfoMaxMemDesc,
+		e.libvirtDomainInfoMemoryDesc,
+		e.libvirtDomainInfoNrVirtCpuDesc,
+		e.libvirtDomainInfoCpuTimeDesc,
+		e.libvirtDomainMemoryStatsActualBalloonDesc,
+		e.libvirtDomainMemoryStatsAvailableDesc,
+		e.libvirtDomainMemoryStatsUnusedDesc,
+		e.libvirtDomainMemoryStatsUsableDesc,
+		e.libvirtDomainMemoryStatsRssDesc,
+		e.libvirtDomainMemoryStatsDiskCachesDesc,
+		e.libvirtDomainMemoryStatsSwapInDesc,
+		e.libvirtDomainMemoryStatsSwapOutDesc,
+		e.libvirtDomainMemoryStatsMajorFaultDesc,
+		e.libvirtDomainMemoryStatsMinorFaultDesc,
+	} {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, 0, domainLabelValues...)
+	}
+	ch <- infoMetric(e.libvirtDomainInfoDesc,
+		append(domainLabelValues, c.desc.Type, c.desc.OS.Type.Type, c.desc.OS.Type.Arch, c.desc.OS.Type.Machine)...)
+	for _, state := range domainStates {
+		ch <- prometheus.MustNewConstMetric(e.libvirtDomainStateDesc, prometheus.UntypedValue, 0,
+			append(domainLabelValues, state.name)...)
+	}
+	e.CollectDomainOpenstackInfo(ch, c.desc.Name, c.desc)
+	if e.exportNanoseconds {
+		ch <- prometheus.MustNewConstMetric(e.libvirtDomainInfoCpuTimeNsDesc, prometheus.UntypedValue, 0, domainLabelValues...)
+	}
+
+	for vcpu := uint(0); vcpu < c.desc.Vcpu.Count; vcpu++ {
+		vcpuLabelValues := append(domainLabelValues, strconv.FormatUint(uint64(vcpu), 10))
+		ch <- prometheus.MustNewConstMetric(e.libvirtDomainVcpuTimeDesc, prometheus.UntypedValue, 0, vcpuLabelValues...)
+		if e.exportNanoseconds {
+			ch <- prometheus.MustNewConstMetric(e.libvirtDomainVcpuTimeNsDesc, prometheus.UntypedValue, 0, vcpuLabelValues...)
+		}
+	}
+
+	for _, channel := range c.desc.Devices.Channels {
+		if channel.Target.State != "" {
+			ch <- prometheus.MustNewConstMetric(e.libvirtDomainChannelConnectedDesc, prometheus.UntypedValue, 0,
+				append(domainLabelValues, channel.Target.Name)...)
+		}
+	}
+	e.CollectDomainClock(ch, domainLabelValues, c.desc)
+	e.CollectDomainHyperV(ch, domainLabelValues, c.desc)
+	e.CollectDomainPlatformFeatures(ch, domainLabelValues, c.desc)
+	e.CollectDomainNestedVirtualization(ch, domainLabelValues, c.desc)
+	e.CollectDomainCPUTopology(ch, domainLabelValues, c.desc)
+	e.CollectDomainDevices(ch, domainLabelValues, c.desc)
+	e.CollectDomainGraphics(ch, domainLabelValues, c.desc)
+	e.CollectDomainResctrl(ch, c.desc.Name, domainLabelValues, c.desc)
+	e.CollectDomainShmem(ch, c.desc.Name, domainLabelValues, c.desc)
+	e.CollectDomainBlkioWeight(ch, c.desc.Name, domainLabelValues, c.desc, false)
+	e.CollectDomainInterfaceMTU(ch, domainLabelValues, c.desc, false)
+	e.CollectDomainLastBackup(ch, nil, c.desc.Name, domainLabelValues, c.desc)
+	e.CollectDomainXMLUnknownFields(ch, domainLabelValues, c.desc)
+	for _, tpm := range c.desc.Devices.TPMs {
+		if tpm.Backend.Type == "emulator" {
+			ch <- prometheus.MustNewConstMetric(e.libvirtDomainTPMEmulatorUpDesc, prometheus.UntypedValue, 0,
+				append(domainLabelValues, tpm.Model, tpm.Backend.Version)...)
+		}
+	}
+
+	for _, disk := range c.desc.Devices.Disks {
+		if disk.Device == "cdrom" || disk.Device == "fd" {
+			continue
+		}
+		blockDescs := []*prometheus.Desc{
+			e.libvirtDomainBlockRdBytesDesc,
+			e.libvirtDomainBlockRdReqDesc,
+			e.libvirtDomainBlockRdTotalTimesDesc,
+			e.libvirtDomainBlockWrBytesDesc,
+			e.libvirtDomainBlockWrReqDesc,
+			e.libvirtDomainBlockWrTotalTimesDesc,
+			e.libvirtDomainBlockFlushReqDesc,
+			e.libvirtDomainBlockFlushTotalTimesDesc,
+			e.libvirtDomainBlockCapacityDesc,
+			e.libvirtDomainBlockAllocationDesc,
+			e.libvirtDomainBlockPhysicalSizeDesc,
+		}
+		if e.exportNanoseconds {
+			blockDescs = append(blockDescs,
+				e.libvirtDomainBlockRdTotalTimesNsDesc,
+				e.libvirtDomainBlockWrTotalTimesNsDesc,
+				e.libvirtDomainBlockFlushTotalTimesNsDesc)
+		}
+		blockLabelValues := append(domainLabelValues, e.blockSourceLabelValue(&disk), disk.Target.Device)
+		for _, desc := range blockDescs {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, 0, blockLabelValues...)
+		}
+		ch <- e.diskInfoMetric(domainLabelValues, &disk)
+		ch <- e.diskEncryptionMetric(domainLabelValues, &disk)
+	}
+
+	for _, iface := range c.desc.Devices.Interfaces {
+		if iface.Target.Device == "" {
+			continue
+		}
+		for _, desc := range []*prometheus.Desc{
+			e.libvirtDomainInterfaceRxBytesDesc,
+			e.libvirtDomainInterfaceRxPacketsDesc,
+			e.libvirtDomainInterfaceRxErrsDesc,
+			e.libvirtDomainInterfaceRxDropDesc,
+			e.libvirtDomainInterfaceTxBytesDesc,
+			e.libvirtDomainInterfaceTxPacketsDesc,
+			e.libvirtDomainInterfaceTxErrsDesc,
+			e.libvirtDomainInterfaceTxDropDesc,
+			e.libvirtDomainInterfaceQueuesDesc,
+			e.libvirtDomainInterfaceQueueLengthDesc,
+			e.libvirtDomainInterfaceRxQueueDropsDesc,
+			e.libvirtDomainInterfaceTxQueueDropsDesc,
+		} {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, 0,
+				append(domainLabelValues, iface.Source.Bridge, iface.Target.Device)...)
+		}
+		if e.exportNWFilters && iface.FilterRef != nil {
+			ch <- prometheus.MustNewConstMetric(e.libvirtDomainInterfaceNWFilterRulesDesc, prometheus.UntypedValue, 0,
+				append(domainLabelValues, iface.Source.Bridge, iface.Target.Device, iface.FilterRef.Filter)...)
+		}
+	}
+}
+
+// PreviewDomainFile writes the metrics and labels that would be exported
+// for the domain described by an XML file, without connecting to libvirt.
+// Fields of the description that are not understood are reported as
+// comments.
+func (e *LibvirtExporter) PreviewDomainFile(w io.Writer, path string) error {
+	xmlDesc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return e.PreviewDomain(w, xmlDesc)
+}
+
+// PreviewDomain writes the metrics and labels that would be exported for
+// the domain described by xmlDesc, like PreviewDomainFile.
+func (e *LibvirtExporter) PreviewDomain(w io.Writer, xmlDesc []byte) error {
+	var desc libvirt_schema.Domain
+	err := xml.Unmarshal(xmlDesc, &desc)
+	if err != nil {
+		return err
+	}
+	for _, field := range desc.UnknownFields() {
+		if _, err := io.WriteString(w, "# Unknown field: "+field+"\n"); err != nil {
+			return err
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(&previewCollector{exporter: e, desc: &desc}); err != nil {
+		return err
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
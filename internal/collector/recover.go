@@ -0,0 +1,37 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// safely runs a collector, turning a panic into an error, so that a bug
+// triggered by a single domain or driver cannot take down the exporter.
+// The stack trace of the panic is logged unthrottled, as it is needed to
+// fix the bug. Only Go panics are recovered from: libvirt calls run in the
+// process of the exporter, so a fault in the C code of libvirt still
+// crashes it.
+func (e *LibvirtExporter) safely(collector string, collect func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in %s collector: %v\n%s", collector, r, debug.Stack())
+			e.libvirtExporterPanicsRecovered.WithLabelValues(collector).Inc()
+			err = &collectError{stage: "panic", err: fmt.Errorf("recovered from panic in %s collector: %v", collector, r)}
+		}
+	}()
+	return collect()
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainResctrl reports the cache and memory bandwidth allocations
+// of a domain, as configured in the <cachetune> and <memorytune> elements
+// of its XML description. Unlike usage statistics, these are reported for
+// inactive domains as well.
+func (e *LibvirtExporter) CollectDomainResctrl(ch chan<- prometheus.Metric, domainName string, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for _, cacheTune := range desc.CPUTune.CacheTunes {
+		for _, cache := range cacheTune.Caches {
+			size, err := libvirt_schema.ScaledBytes(cache.Size, cache.Unit)
+			if err != nil {
+				e.logger.Printf("Failed to parse cache allocation of domain %s: %s", domainName, err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainCacheTuneSizeDesc,
+				prometheus.GaugeValue,
+				float64(size),
+				append(domainLabelValues,
+					cacheTune.VCPUs,
+					strconv.FormatUint(uint64(cache.ID), 10),
+					strconv.FormatUint(uint64(cache.Level), 10),
+					cache.Type)...)
+		}
+	}
+	for _, memoryTune := range desc.CPUTune.MemoryTunes {
+		for _, node := range memoryTune.Nodes {
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtDomainMemoryTuneBandwidthDesc,
+				prometheus.GaugeValue,
+				float64(node.Bandwidth),
+				append(domainLabelValues,
+					memoryTune.VCPUs,
+					strconv.FormatUint(uint64(node.ID), 10))...)
+		}
+	}
+}
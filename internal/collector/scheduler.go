@@ -0,0 +1,216 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errNotCollectedYet is returned by collectors that run in the background
+// until their first run completes. There is no data to report yet, which
+// is not a failure.
+var errNotCollectedYet = errors.New("metrics have not been collected yet")
+
+// CollectorNames lists the collectors whose metrics can be collected in
+// the background with --collector.interval.
+var CollectorNames = []string{"domains", "host", "storage"}
+
+func isCollectorName(name string) bool {
+	for _, collectorName := range CollectorNames {
+		if name == collectorName {
+			return true
+		}
+	}
+	return false
+}
+
+// OptionalCollectorNames lists the collectors that can be disabled with
+// --no-collector.<name>. Besides the host and storage collectors, these
+// include the parts of the domains collector that are the most expensive
+// or noisy.
+var OptionalCollectorNames = []string{"blockstats", "host", "jobstats", "memorystats", "netstats", "storage", "vcpustats"}
+
+// DefaultDisabledCollectorNames lists the optional collectors that are
+// disabled unless enabled with --collector.<name>, as they require a call
+// to libvirt for every domain on every scrape.
+var DefaultDisabledCollectorNames = []string{"jobstats"}
+
+// IsDisabledByDefault returns whether an optional collector is disabled
+// unless enabled explicitly.
+func IsDisabledByDefault(name string) bool {
+	for _, collectorName := range DefaultDisabledCollectorNames {
+		if name == collectorName {
+			return true
+		}
+	}
+	return false
+}
+
+func isOptionalCollectorName(name string) bool {
+	for _, collectorName := range OptionalCollectorNames {
+		if name == collectorName {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduledCollector runs a collector either on every scrape or, if it
+// has an interval, in the background, serving the metrics of its last
+// run from a cache. This allows collectors that are expensive for
+// libvirtd, or whose metrics change slowly, to run less often than
+// Prometheus scrapes.
+type scheduledCollector struct {
+	name     string
+	interval time.Duration
+	collect  func(ch chan<- prometheus.Metric) error
+
+	mu      sync.Mutex
+	metrics []prometheus.Metric
+	err     error
+	updated bool
+
+	// refreshed is closed once the cached metrics have been refreshed
+	// for the first time.
+	refreshed     chan struct{}
+	refreshedOnce sync.Once
+}
+
+func newScheduledCollector(e *LibvirtExporter, name string, interval time.Duration, collect func(ch chan<- prometheus.Metric) error) *scheduledCollector {
+	return &scheduledCollector{
+		name:      name,
+		interval:  interval,
+		refreshed: make(chan struct{}),
+		collect: func(ch chan<- prometheus.Metric) error {
+			seconds, err := e.traced(name, func() error {
+				return e.safely(name, func() error {
+					return collect(ch)
+				})
+			})
+			ch <- prometheus.MustNewConstMetric(
+				e.libvirtScrapeDurationDesc,
+				prometheus.GaugeValue,
+				seconds,
+				name)
+			return err
+		},
+	}
+}
+
+// Collect emits the metrics of the collector and returns the error of
+// the run that produced them.
+func (c *scheduledCollector) Collect(ch chan<- prometheus.Metric) error {
+	if c.interval <= 0 {
+		return c.collect(ch)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.updated {
+		return errNotCollectedYet
+	}
+	for _, metric := range c.metrics {
+		ch <- metric
+	}
+	return c.err
+}
+
+// refresh runs the collector, replacing the cached metrics.
+func (c *scheduledCollector) refresh() {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var metrics []prometheus.Metric
+	go func() {
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		close(done)
+	}()
+	err := c.collect(ch)
+	close(ch)
+	<-done
+
+	c.mu.Lock()
+	c.metrics, c.err, c.updated = metrics, err, true
+	c.mu.Unlock()
+	c.refreshedOnce.Do(func() {
+		close(c.refreshed)
+	})
+}
+
+// run refreshes the cached metrics of the collector every interval, until
+// stop is closed.
+func (c *scheduledCollector) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.refresh()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// StartCollectors starts collecting the metrics of the collectors that
+// have an interval in the background, and watching domain events and
+// the audit log if enabled.
+func (e *LibvirtExporter) StartCollectors() {
+	for _, c := range e.collectors {
+		if c.interval > 0 {
+			go c.run(e.stop)
+		}
+	}
+	if e.watchEvents {
+		go e.watchDomainEvents(e.stop)
+	}
+	if e.securityDenials != nil {
+		go e.securityDenials.run(e.stop, e.logger)
+	}
+}
+
+// WarmUp connects to libvirt, so that the first scrape finds a connection
+// open in the pool, and waits for the collectors that run in the
+// background to fill their cache. The collectors that run on every scrape
+// are not run: their metrics could not be served by the first scrape, and
+// running them would only double the load on libvirtd at startup and
+// count in their statistics. It must be called after StartCollectors, and
+// returns early if the collectors are stopped.
+func (e *LibvirtExporter) WarmUp() {
+	if conn, err := e.connect(); err != nil {
+		e.logger.Printf("Failed to connect to libvirt while warming up: %s", err)
+	} else {
+		conn.Close()
+	}
+	for _, c := range e.collectors {
+		if c.interval <= 0 {
+			continue
+		}
+		select {
+		case <-c.refreshed:
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// StopCollectors stops collecting metrics in the background, once the
+// runs in progress complete.
+func (e *LibvirtExporter) StopCollectors() {
+	close(e.stop)
+}
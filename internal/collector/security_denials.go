@@ -0,0 +1,203 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// auditLogPollInterval is the interval at which the audit log is read for
+// new denials.
+const auditLogPollInterval = 5 * time.Second
+
+var (
+	// selinuxDenialRegexp matches the AVC denials of SELinux, capturing
+	// the context of the process that was denied, such as
+	// "system_u:system_r:svirt_t:s0:c392,c662".
+	selinuxDenialRegexp = regexp.MustCompile(`avc:\s+denied\s.*\sscontext=(\S+)`)
+	// apparmorDenialRegexp matches the denials of AppArmor, capturing the
+	// profile of the process that was denied, such as
+	// "libvirt-6695eb01-f6a4-8304-79aa-97f2502e193f".
+	apparmorDenialRegexp = regexp.MustCompile(`apparmor="DENIED".*\sprofile="([^"]+)"`)
+)
+
+// securityDenials counts the AppArmor and SELinux denials logged in an
+// audit log, by the security label of the process that was denied, which
+// is that of the domain for QEMU processes. Only the denials logged after
+// the exporter started are counted. Labels are generated anew whenever a
+// domain starts, so the counts of labels that are neither logged nor
+// reported during a run of the domains collector are dropped by the next
+// one. A nil securityDenials counts nothing.
+type securityDenials struct {
+	path string
+
+	mu     sync.Mutex
+	counts map[string]uint64
+	used   map[string]bool
+
+	// partial holds the beginning of a line whose end was not written
+	// yet, and offset the position in the file up to which it was read.
+	partial string
+	offset  int64
+}
+
+func newSecurityDenials(path string) *securityDenials {
+	return &securityDenials{
+		path:   path,
+		counts: map[string]uint64{},
+		used:   map[string]bool{},
+	}
+}
+
+// count records the denial logged on a line, if any.
+func (d *securityDenials) count(line string) {
+	var label string
+	if m := selinuxDenialRegexp.FindStringSubmatch(line); m != nil {
+		label = m[1]
+	} else if m := apparmorDenialRegexp.FindStringSubmatch(line); m != nil {
+		// Denials of child profiles, such as that of the bridge
+		// helper, are attributed to the profile of the domain.
+		label = strings.SplitN(m[1], "//", 2)[0]
+	} else {
+		return
+	}
+	d.mu.Lock()
+	d.counts[label]++
+	d.used[label] = true
+	d.mu.Unlock()
+}
+
+// denials returns the number of denials of the given security label.
+func (d *securityDenials) denials(label string) uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.used[label] = true
+	return d.counts[label]
+}
+
+// rotate drops the counts of the labels that were neither counted nor
+// reported since the previous rotation, which is done on every run of
+// the domains collector.
+func (d *securityDenials) rotate() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for label := range d.counts {
+		if !d.used[label] {
+			delete(d.counts, label)
+		}
+	}
+	d.used = map[string]bool{}
+}
+
+// readLines counts the denials of the complete lines that were appended
+// to the file since it was last read.
+func (d *securityDenials) readLines(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		d.offset += int64(len(line))
+		d.partial += line
+		if err != nil {
+			return
+		}
+		d.count(d.partial)
+		d.partial = ""
+	}
+}
+
+// run reads the audit log every auditLogPollInterval until stop is
+// closed, following it when it is rotated or truncated.
+func (d *securityDenials) run(stop <-chan struct{}, logger *ThrottledLogger) {
+	var (
+		file   *os.File
+		reader *bufio.Reader
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	// Denials logged before the exporter started are skipped, but all
+	// those of the files that replace the log when it is rotated are
+	// counted.
+	skip := true
+	ticker := time.NewTicker(auditLogPollInterval)
+	defer ticker.Stop()
+	for {
+		if file == nil {
+			f, err := os.Open(d.path)
+			if err != nil {
+				logger.Printf("Failed to open audit log: %s", err)
+			} else {
+				file, reader, d.offset, d.partial = f, bufio.NewReader(f), 0, ""
+				if skip {
+					d.offset, err = f.Seek(0, io.SeekEnd)
+					if err != nil {
+						logger.Printf("Failed to seek to the end of the audit log: %s", err)
+					}
+				}
+				skip = false
+			}
+		}
+		if file != nil {
+			d.readLines(reader)
+			opened, err1 := file.Stat()
+			current, err2 := os.Stat(d.path)
+			if err1 != nil || err2 != nil || !os.SameFile(opened, current) {
+				// The end of the rotated file was read above.
+				file.Close()
+				file = nil
+			} else if current.Size() < d.offset {
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					logger.Printf("Failed to seek to the start of the audit log: %s", err)
+				}
+				reader.Reset(file)
+				d.offset, d.partial = 0, ""
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CollectDomainSecurityDenials reports the number of AppArmor and SELinux
+// denials logged for the security labels of a domain, which are only
+// known while it runs if they are generated dynamically.
+func (e *LibvirtExporter) CollectDomainSecurityDenials(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for _, seclabel := range desc.SecLabels {
+		if seclabel.Label == "" {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainSecurityDenialsDesc,
+			prometheus.CounterValue,
+			float64(e.securityDenials.denials(seclabel.Label)),
+			append(domainLabelValues, seclabel.Model)...)
+	}
+}
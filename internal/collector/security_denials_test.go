@@ -0,0 +1,51 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+func TestSecurityDenials(t *testing.T) {
+	t.Parallel()
+	d := newSecurityDenials("")
+	d.count(`type=AVC msg=audit(1700000000.000:1): avc:  denied  { read } for pid=1 comm="qemu-kvm" scontext=system_u:system_r:svirt_t:s0:c1,c2 tcontext=system_u:object_r:etc_t:s0 tclass=file`)
+	d.count(`type=AVC msg=audit(1700000000.000:2): apparmor="DENIED" operation="open" profile="libvirt-6695eb01//qemu_bridge_helper" name="/etc/shadow"`)
+	d.count(`type=AVC msg=audit(1700000000.000:3): apparmor="DENIED" operation="open" profile="libvirt-6695eb01" name="/etc/shadow"`)
+	d.count(`type=SYSCALL msg=audit(1700000000.000:4): arch=c000003e syscall=2`)
+
+	// Denials logged since the previous rotation are kept, even if they
+	// were not reported yet.
+	d.rotate()
+	if got := d.denials("system_u:system_r:svirt_t:s0:c1,c2"); got != 1 {
+		t.Errorf("Got %d SELinux denials, want 1", got)
+	}
+	if got := d.denials("libvirt-6695eb01"); got != 2 {
+		t.Errorf("Got %d AppArmor denials, want 2", got)
+	}
+
+	// Labels that are still reported are kept, the others are dropped.
+	d.rotate()
+	d.denials("libvirt-6695eb01")
+	d.rotate()
+	if _, ok := d.counts["system_u:system_r:svirt_t:s0:c1,c2"]; ok {
+		t.Error("Count of a label that is no longer reported was kept")
+	}
+	if got := d.denials("libvirt-6695eb01"); got != 2 {
+		t.Errorf("Got %d AppArmor denials after a rotation, want 2", got)
+	}
+	d.rotate()
+	d.rotate()
+	if len(d.counts) != 0 {
+		t.Errorf("Holding %d counts after an unused rotation, want 0", len(d.counts))
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// defaultShmemSize is the size QEMU gives to shared memory devices whose
+// size is not set.
+const defaultShmemSize = 4 << 20
+
+// CollectDomainShmem reports the shared memory devices of a domain, as
+// found in its XML description. Their memory is allocated on the host in
+// addition to the memory of the domain, and is not reported by
+// libvirt_domain_info_memory_usage_bytes.
+func (e *LibvirtExporter) CollectDomainShmem(ch chan<- prometheus.Metric, domainName string, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for _, shmem := range desc.Devices.Shmems {
+		size := uint64(defaultShmemSize)
+		if shmem.Size != nil {
+			var err error
+			size, err = libvirt_schema.ScaledBytes(shmem.Size.Value, shmem.Size.Unit)
+			if err != nil {
+				e.logger.Printf("Failed to parse size of shared memory device %s of domain %s: %s", shmem.Name, domainName, err)
+				continue
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainShmemSizeDesc,
+			prometheus.GaugeValue,
+			float64(size),
+			append(domainLabelValues, shmem.Name, shmem.Model.Type)...)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+
+	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// storagePoolStates maps the states of storage pools to the values of the
+// state label of libvirt_storage_pool_state.
+var storagePoolStates = []struct {
+	state libvirt.StoragePoolState
+	name  string
+}{
+	{libvirt.STORAGE_POOL_INACTIVE, "inactive"},
+	{libvirt.STORAGE_POOL_BUILDING, "building"},
+	{libvirt.STORAGE_POOL_RUNNING, "running"},
+	{libvirt.STORAGE_POOL_DEGRADED, "degraded"},
+	{libvirt.STORAGE_POOL_INACCESSIBLE, "inaccessible"},
+}
+
+// storageVolTypes maps the types of storage volumes to the values of the
+// type label of storage volume metrics.
+var storageVolTypes = map[libvirt.StorageVolType]string{
+	libvirt.STORAGE_VOL_FILE:    "file",
+	libvirt.STORAGE_VOL_BLOCK:   "block",
+	libvirt.STORAGE_VOL_DIR:     "dir",
+	libvirt.STORAGE_VOL_NETWORK: "network",
+	libvirt.STORAGE_VOL_NETDIR:  "netdir",
+	libvirt.STORAGE_VOL_PLOOP:   "ploop",
+}
+
+// CollectStoragePools reports the state and usage of all storage pools,
+// and of their volumes if enabled. Failing to collect a single pool is
+// not fatal: the error is logged and the pool is omitted.
+func (e *LibvirtExporter) CollectStoragePools(ch chan<- prometheus.Metric, conn *libvirt.Connect) error {
+	pools, err := conn.ListAllStoragePools(0)
+	if err != nil {
+		e.countError("virConnectListAllStoragePools", err)
+		return err
+	}
+	for _, pool := range pools {
+		if err := e.CollectStoragePool(ch, &pool); err != nil {
+			name, _ := pool.GetName()
+			e.logger.Printf("Failed to collect metrics of storage pool %s: %s", name, err)
+		}
+		pool.Free()
+	}
+	return nil
+}
+
+// CollectStoragePool reports the state and usage of a storage pool.
+func (e *LibvirtExporter) CollectStoragePool(ch chan<- prometheus.Metric, pool *libvirt.StoragePool) error {
+	poolName, err := pool.GetName()
+	if err != nil {
+		e.countError("virStoragePoolGetName", err)
+		return err
+	}
+	xmlDesc, err := pool.GetXMLDesc(0)
+	if err != nil {
+		e.countError("virStoragePoolGetXMLDesc", err)
+		return err
+	}
+	var desc libvirt_schema.StoragePool
+	if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+		return err
+	}
+	info, err := pool.GetInfo()
+	if err != nil {
+		e.countError("virStoragePoolGetInfo", err)
+		return err
+	}
+
+	for _, state := range storagePoolStates {
+		value := 0.0
+		if info.State == state.state {
+			value = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtStoragePoolStateDesc,
+			prometheus.GaugeValue,
+			value,
+			poolName,
+			desc.Type,
+			state.name)
+	}
+	// Sizes are only known while the pool is running.
+	if info.State != libvirt.STORAGE_POOL_RUNNING && info.State != libvirt.STORAGE_POOL_DEGRADED {
+		return nil
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtStoragePoolCapacityDesc,
+		prometheus.GaugeValue,
+		float64(info.Capacity),
+		poolName,
+		desc.Type)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtStoragePoolAllocationDesc,
+		prometheus.GaugeValue,
+		float64(info.Allocation),
+		poolName,
+		desc.Type)
+	ch <- prometheus.MustNewConstMetric(
+		e.libvirtStoragePoolAvailableDesc,
+		prometheus.GaugeValue,
+		float64(info.Available),
+		poolName,
+		desc.Type)
+
+	if !e.exportVolumes {
+		return nil
+	}
+	vols, err := pool.ListAllStorageVolumes(0)
+	if err != nil {
+		e.countError("virStoragePoolListAllVolumes", err)
+		return err
+	}
+	defer func() {
+		for i := range vols {
+			vols[i].Free()
+		}
+	}()
+	for i := range vols {
+		volName, err := vols[i].GetName()
+		if err != nil {
+			e.countError("virStorageVolGetName", err)
+			return err
+		}
+		volInfo, err := vols[i].GetInfo()
+		if err != nil {
+			e.countError("virStorageVolGetInfo", err)
+			// Volumes may be deleted while the pool is listed.
+			e.logger.Printf("Failed to obtain information of volume %s of storage pool %s: %s", volName, poolName, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtStorageVolCapacityDesc,
+			prometheus.GaugeValue,
+			float64(volInfo.Capacity),
+			poolName,
+			volName,
+			storageVolTypes[volInfo.Type])
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtStorageVolAllocationDesc,
+			prometheus.GaugeValue,
+			float64(volInfo.Allocation),
+			poolName,
+			volName,
+			storageVolTypes[volInfo.Type])
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// sysClassNetDir is the directory under which the kernel exposes network
+// devices.
+const sysClassNetDir = "/sys/class/net"
+
+// isLocalURI returns whether a libvirt URI refers to the host the exporter
+// runs on, whose devices can then be inspected directly.
+func isLocalURI(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && u.Host == ""
+}
+
+// tapQueues holds the queue configuration and drop counters of the host
+// side of a network interface.
+type tapQueues struct {
+	queues    int
+	length    uint64
+	rxDropped uint64
+	txDropped uint64
+}
+
+// readTapQueues reads the queues of a tap device from sysfs.
+func readTapQueues(device string) (*tapQueues, error) {
+	dir := filepath.Join(sysClassNetDir, filepath.Base(device))
+	queues, err := filepath.Glob(filepath.Join(dir, "queues", "tx-*"))
+	if err != nil {
+		return nil, err
+	}
+	var t tapQueues
+	t.queues = len(queues)
+	for _, field := range []struct {
+		path  string
+		value *uint64
+	}{
+		{"tx_queue_len", &t.length},
+		{"statistics/rx_dropped", &t.rxDropped},
+		{"statistics/tx_dropped", &t.txDropped},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, field.path))
+		if err != nil {
+			return nil, err
+		}
+		*field.value, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// CollectDomainTapQueues reports the queues of the tap devices backing the
+// network interfaces of a running domain. The tap device drops packets
+// towards the guest when its queues are full, i.e. when the guest does not
+// process them quickly enough. As the host side of the device is seen,
+// its receive and transmit directions are swapped to match those of the
+// guest.
+func (e *LibvirtExporter) CollectDomainTapQueues(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for _, iface := range desc.Devices.Interfaces {
+		if iface.Target.Device == "" {
+			continue
+		}
+		t, err := readTapQueues(iface.Target.Device)
+		if err != nil {
+			// Not every interface is backed by a tap device.
+			continue
+		}
+		interfaceLabelValues := append(domainLabelValues, iface.Source.Bridge, iface.Target.Device)
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInterfaceQueuesDesc,
+			prometheus.GaugeValue,
+			float64(t.queues),
+			interfaceLabelValues...)
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInterfaceQueueLengthDesc,
+			prometheus.GaugeValue,
+			float64(t.length),
+			interfaceLabelValues...)
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInterfaceRxQueueDropsDesc,
+			prometheus.CounterValue,
+			float64(t.txDropped),
+			interfaceLabelValues...)
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainInterfaceTxQueueDropsDesc,
+			prometheus.CounterValue,
+			float64(t.rxDropped),
+			interfaceLabelValues...)
+	}
+}
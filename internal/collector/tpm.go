@@ -0,0 +1,86 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainTPM reports the health of the swtpm processes backing the
+// emulated TPMs of a running domain. A dead swtpm process goes unnoticed
+// by libvirt, while guests relying on their TPM, e.g. for disk
+// encryption, stop working.
+func (e *LibvirtExporter) CollectDomainTPM(ch chan<- prometheus.Metric, id uint, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	for _, tpm := range desc.Devices.TPMs {
+		if tpm.Backend.Type != "emulator" {
+			continue
+		}
+		up := 0.0
+		if e.swtpmAlive(id) {
+			up = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainTPMEmulatorUpDesc,
+			prometheus.GaugeValue,
+			up,
+			append(domainLabelValues, tpm.Model, tpm.Backend.Version)...)
+	}
+}
+
+// swtpmAlive returns whether the swtpm process of the running domain with
+// the given identifier is alive and its socket exists. libvirt names these
+// files after the short name of the domain, "<id>-<truncated name>", so
+// they are looked up by identifier, which is unique among running domains.
+func (e *LibvirtExporter) swtpmAlive(id uint) bool {
+	files, err := ioutil.ReadDir(e.swtpmStateDir)
+	if err != nil {
+		return false
+	}
+	prefix := strconv.FormatUint(uint64(id), 10) + "-"
+	var pidFile, socket string
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasSuffix(name, "-swtpm.pid") {
+			pidFile = filepath.Join(e.swtpmStateDir, name)
+		} else if strings.HasSuffix(name, "-swtpm.sock") && file.Mode()&os.ModeSocket != 0 {
+			socket = filepath.Join(e.swtpmStateDir, name)
+		}
+	}
+	if pidFile == "" || socket == "" {
+		return false
+	}
+
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(fmt.Sprintf("/proc/%d", pid))
+	return err == nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traced runs a collector and returns its duration in seconds, which is
+// observed by libvirt_collector_duration_seconds. If tracing is enabled,
+// the run is covered by a span, and the trace ID of sampled runs is
+// attached to the observation as an exemplar, so that a slow run can be
+// followed to its trace.
+func (e *LibvirtExporter) traced(collector string, collect func() error) (float64, error) {
+	var span trace.Span
+	if e.tracer != nil {
+		_, span = e.tracer.Start(context.Background(), "collect "+collector,
+			trace.WithAttributes(attribute.String("libvirt.uri", e.uri)))
+	}
+	start := time.Now()
+	err := collect()
+	seconds := time.Since(start).Seconds()
+
+	observer := e.libvirtCollectorDuration.WithLabelValues(collector)
+	if span == nil {
+		observer.Observe(seconds)
+		return seconds, err
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	if spanContext := span.SpanContext(); spanContext.IsSampled() {
+		observer.(prometheus.ExemplarObserver).ObserveWithExemplar(seconds, prometheus.Labels{"trace_id": spanContext.TraceID().String()})
+	} else {
+		observer.Observe(seconds)
+	}
+	return seconds, err
+}
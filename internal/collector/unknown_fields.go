@@ -0,0 +1,44 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+// CollectDomainXMLUnknownFields reports the attributes and elements of
+// the XML description of a domain that are not understood by the
+// exporter where labels are derived from, with the number of devices
+// they appear in. They are reported on every scrape from the current
+// description, so that they disappear once the domain is redefined or
+// removed.
+func (e *LibvirtExporter) CollectDomainXMLUnknownFields(ch chan<- prometheus.Metric, domainLabelValues []string, desc *libvirt_schema.Domain) {
+	counts := map[string]int{}
+	var fields []string
+	for _, field := range desc.UnknownFields() {
+		if counts[field] == 0 {
+			fields = append(fields, field)
+		}
+		counts[field]++
+	}
+	for _, field := range fields {
+		ch <- prometheus.MustNewConstMetric(
+			e.libvirtDomainXMLUnknownFieldsDesc,
+			prometheus.GaugeValue,
+			float64(counts[field]),
+			append(domainLabelValues, field)...)
+	}
+}
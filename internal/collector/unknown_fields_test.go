@@ -0,0 +1,75 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/priteau/libvirt_exporter/libvirt_schema"
+)
+
+const unknownFieldsDomain = `<domain type='kvm'>
+  <name>vm</name>
+  <devices>
+    <disk type='file' device='disk'><source file='/var/lib/a' index='1' unknown='1'/><target dev='vda'/></disk>
+    <disk type='file' device='disk'><source file='/var/lib/b' index='2' unknown='2'/><target dev='vdb'/></disk>
+    <interface type='network'><source network='default' portid='0f1bd6a2-9a0e-4c6b-8b8e-3c8b5f2d1a7e' bridge='virbr0'><reservation/></source><target dev='vnet0'/></interface>
+  </devices>
+</domain>`
+
+// collectUnknownFields returns the values of the unknown fields reported
+// for a domain, by field.
+func collectUnknownFields(t *testing.T, e *LibvirtExporter, desc *libvirt_schema.Domain) map[string]float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 16)
+	e.CollectDomainXMLUnknownFields(ch, e.domainLabelValues(desc.Name, desc), desc)
+	close(ch)
+	values := map[string]float64{}
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatalf("Failed to write metric: %s", err)
+		}
+		for _, pair := range m.GetLabel() {
+			if pair.GetName() == "field" {
+				values[pair.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestUnknownFields(t *testing.T) {
+	var desc libvirt_schema.Domain
+	if err := xml.Unmarshal([]byte(unknownFieldsDomain), &desc); err != nil {
+		t.Fatalf("Failed to parse domain: %s", err)
+	}
+	e := newTestExporter(t, testURI)
+	want := map[string]float64{
+		"disk/source@unknown":          2,
+		"interface/source/reservation": 1,
+	}
+	// Fields are reported from the description, not counted across
+	// scrapes.
+	for scrape := 0; scrape < 2; scrape++ {
+		if got := collectUnknownFields(t, e, &desc); !reflect.DeepEqual(got, want) {
+			t.Errorf("Scrape %d reported unknown fields %v, want %v", scrape, got, want)
+		}
+	}
+}
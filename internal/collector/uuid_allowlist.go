@@ -0,0 +1,90 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UUIDAllowlist is a set of domain UUIDs read from a file, holding one UUID
+// per line. Empty lines and lines starting with '#' are ignored. The file
+// is read again whenever it changes, so that orchestrators can update it
+// without restarting the exporter.
+type UUIDAllowlist struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	uuids   map[string]bool
+}
+
+// NewUUIDAllowlist returns the allowlist of the UUIDs listed in a file,
+// failing if it cannot be read.
+func NewUUIDAllowlist(path string) (*UUIDAllowlist, error) {
+	a := &UUIDAllowlist{path: path}
+	if err := a.Refresh(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Refresh reads the file again if it changed since it was last read. If
+// it cannot be read, the previous UUIDs are kept.
+func (a *UUIDAllowlist) Refresh() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	unchanged := a.uuids != nil && info.ModTime().Equal(a.modTime) && info.Size() == a.size
+	a.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	uuids := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		uuids[strings.ToLower(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.modTime, a.size, a.uuids = info.ModTime(), info.Size(), uuids
+	a.mu.Unlock()
+	return nil
+}
+
+// Contains returns whether the allowlist holds the given UUID.
+func (a *UUIDAllowlist) Contains(uuid string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.uuids[strings.ToLower(uuid)]
+}
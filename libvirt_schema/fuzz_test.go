@@ -0,0 +1,114 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt_schema
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+// seedDomain is a domain description exercising most of the schema.
+const seedDomain = `<domain type='kvm'>
+  <name>instance-00000001</name>
+  <uuid>6695eb01-f6a4-8304-79aa-97f2502e193f</uuid>
+  <metadata>
+    <nova:instance xmlns:nova="http://openstack.org/xmlns/libvirt/nova/1.0">
+      <nova:name>vm</nova:name>
+      <nova:flavor name="m1.small"/>
+      <nova:owner>
+        <nova:user uuid="user"/>
+        <nova:project uuid="project"/>
+      </nova:owner>
+    </nova:instance>
+  </metadata>
+  <vcpu current='1'>2</vcpu>
+  <os><type arch='x86_64' machine='pc'>hvm</type></os>
+  <features><hyperv mode='custom'><spinlocks state='on' retries='8191'/></hyperv></features>
+  <clock offset='utc'><timer name='rtc' tickpolicy='catchup'/></clock>
+  <devices>
+    <disk type='network' device='disk'>
+      <source protocol='rbd' name='volumes/volume-1'><host name='ceph' port='6789'/></source>
+      <target dev='vda' bus='virtio'/>
+      <encryption format='luks'/>
+    </disk>
+    <disk type='file' device='disk'>
+      <source file='/var/lib/disk' index='1'><unknown/></source>
+      <target dev='sda' bus='scsi'/>
+      <address type='drive' controller='0'/>
+    </disk>
+    <controller type='scsi' index='0' model='virtio-scsi'/>
+    <interface type='bridge'>
+      <source bridge='br0'/>
+      <target dev='tap0'/>
+      <model type='virtio'/>
+      <filterref filter='clean-traffic'/>
+    </interface>
+    <graphics type='vnc' port='5900' autoport='yes'><listen type='address' address='127.0.0.1'/></graphics>
+    <shmem name='shmem0'><model type='ivshmem-plain'/><size unit='M'>4</size></shmem>
+    <tpm model='tpm-crb'><backend type='emulator' version='2.0'/></tpm>
+  </devices>
+</domain>`
+
+func FuzzDomain(f *testing.F) {
+	f.Add([]byte(seedDomain))
+	f.Add([]byte(`<domain/>`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Parsing is lenient, so the methods of a partially decoded
+		// description must not fail either.
+		var desc Domain
+		xml.Unmarshal(data, &desc)
+		desc.UnknownFields()
+		desc.Vcpu.CurrentCount()
+		desc.Metadata.NovaInstance.IsSet()
+		for i := range desc.Devices.Disks {
+			desc.Devices.Disks[i].SourceName()
+			desc.Devices.Disks[i].GetEncryption()
+		}
+		for i := range desc.Devices.Graphics {
+			desc.Devices.Graphics[i].ListensOnTCP()
+			desc.Devices.Graphics[i].ListenAddress()
+		}
+		for _, shmem := range desc.Devices.Shmems {
+			if shmem.Size != nil {
+				ScaledBytes(shmem.Size.Value, shmem.Size.Unit)
+			}
+		}
+	})
+}
+
+func FuzzSysinfo(f *testing.F) {
+	f.Add([]byte(`<sysinfo type='smbios'><bios><entry name='vendor'>SeaBIOS</entry></bios><system><entry name='product'>Standard PC</entry></system></sysinfo>`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var sysinfo Sysinfo
+		xml.Unmarshal(data, &sysinfo)
+		sysinfo.BIOS.Get("vendor")
+		sysinfo.System.Get("product")
+	})
+}
+
+func FuzzStoragePool(f *testing.F) {
+	f.Add([]byte(`<pool type='dir'><name>default</name></pool>`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var pool StoragePool
+		xml.Unmarshal(data, &pool)
+	})
+}
+
+func FuzzNWFilter(f *testing.F) {
+	f.Add([]byte(`<filter name='clean-traffic'><filterref filter='no-mac-spoofing'/><rule action='accept' direction='out'/></filter>`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var filter NWFilter
+		xml.Unmarshal(data, &filter)
+	})
+}
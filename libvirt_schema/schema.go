@@ -13,15 +13,236 @@
 
 package libvirt_schema
 
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
 type Domain struct {
-	Devices  Devices  `xml:"devices"`
-	Metadata Metadata `xml:"metadata"`
-	UUID     string   `xml:"uuid"`
+	Type      string     `xml:"type,attr"`
+	BlkioTune BlkioTune  `xml:"blkiotune"`
+	Clock     Clock      `xml:"clock"`
+	CPU       CPU        `xml:"cpu"`
+	CPUTune   CPUTune    `xml:"cputune"`
+	Devices   Devices    `xml:"devices"`
+	Features  Features   `xml:"features"`
+	Metadata  Metadata   `xml:"metadata"`
+	Name      string     `xml:"name"`
+	OS        OS         `xml:"os"`
+	SecLabels []SecLabel `xml:"seclabel"`
+	UUID      string     `xml:"uuid"`
+	Vcpu      Vcpu       `xml:"vcpu"`
+}
+
+// BlkioTune holds the I/O tuning parameters of a domain. A weight of 0
+// means that it is not set.
+type BlkioTune struct {
+	Weight uint `xml:"weight"`
+}
+
+// SecLabel is a security label of a domain, such as the SELinux context
+// or the AppArmor profile of its QEMU process. Dynamic labels are only
+// present in the XML description of running domains.
+type SecLabel struct {
+	Type  string `xml:"type,attr"`
+	Model string `xml:"model,attr"`
+	Label string `xml:"label"`
+}
+
+// CPU is the model of the virtual CPU of a domain, and the features added
+// to or removed from it. The mode is custom when not set.
+type CPU struct {
+	Mode     string       `xml:"mode,attr"`
+	Model    string       `xml:"model"`
+	Topology *CPUTopology `xml:"topology"`
+	Features []CPUFeature `xml:"feature"`
+}
+
+// CPUTopology is the topology of the virtual CPUs of a domain. Dies is 0
+// when not set, which means a single die per socket.
+type CPUTopology struct {
+	Sockets uint `xml:"sockets,attr"`
+	Dies    uint `xml:"dies,attr"`
+	Cores   uint `xml:"cores,attr"`
+	Threads uint `xml:"threads,attr"`
+}
+
+// CPUFeature is a feature of the host CPU added to or removed from the
+// virtual CPU, such as vmx. The policy is require when not set.
+type CPUFeature struct {
+	Policy string `xml:"policy,attr"`
+	Name   string `xml:"name,attr"`
+}
+
+type OS struct {
+	Type OSType `xml:"type"`
+}
+
+type OSType struct {
+	Arch    string `xml:"arch,attr"`
+	Machine string `xml:"machine,attr"`
+	Type    string `xml:",chardata"`
+}
+
+type Vcpu struct {
+	Count   uint `xml:",chardata"`
+	Current uint `xml:"current,attr"`
+}
+
+// CurrentCount returns the number of virtual CPUs that are currently
+// enabled, which defaults to the maximum number of virtual CPUs.
+func (v *Vcpu) CurrentCount() uint {
+	if v.Current != 0 {
+		return v.Current
+	}
+	return v.Count
+}
+
+type Features struct {
+	HyperV *HyperV `xml:"hyperv"`
+	// Others holds the other features, such as <gic> on aarch64 or
+	// <htm> on ppc64.
+	Others []Feature `xml:",any"`
+}
+
+// Feature is a feature of the platform of a domain. Depending on the
+// feature, its setting is held by its state, value, version or resizing
+// attribute.
+type Feature struct {
+	XMLName  xml.Name
+	State    string `xml:"state,attr"`
+	Value    string `xml:"value,attr"`
+	Version  string `xml:"version,attr"`
+	Resizing string `xml:"resizing,attr"`
+}
+
+// HyperV is the configuration of the Hyper-V enlightenments exposed to
+// Windows guests, which are the elements of <hyperv>, such as <relaxed>,
+// <vapic>, <spinlocks> or <stimer>.
+type HyperV struct {
+	Mode           string                `xml:"mode,attr"`
+	Enlightenments []HyperVEnlightenment `xml:",any"`
+}
+
+type HyperVEnlightenment struct {
+	XMLName xml.Name
+	State   string `xml:"state,attr"`
+	// Retries is only set for <spinlocks>, and Value for <vendor_id>.
+	Retries string `xml:"retries,attr"`
+	Value   string `xml:"value,attr"`
+	// Direct is only set for <stimer>.
+	Direct *HyperVEnlightenmentState `xml:"direct"`
+}
+
+type HyperVEnlightenmentState struct {
+	State string `xml:"state,attr"`
+}
+
+// Clock is the configuration of the clock of the guest, and of the timers
+// it is given.
+type Clock struct {
+	Offset   string `xml:"offset,attr"`
+	Timezone string `xml:"timezone,attr"`
+	Basis    string `xml:"basis,attr"`
+	// Adjustment is an offset in seconds for variable clocks, or
+	// "reset".
+	Adjustment string  `xml:"adjustment,attr"`
+	Timers     []Timer `xml:"timer"`
+}
+
+type Timer struct {
+	Name       string `xml:"name,attr"`
+	Present    string `xml:"present,attr"`
+	TickPolicy string `xml:"tickpolicy,attr"`
+	Track      string `xml:"track,attr"`
+	Mode       string `xml:"mode,attr"`
+	Frequency  string `xml:"frequency,attr"`
+}
+
+type CPUTune struct {
+	CacheTunes  []CacheTune  `xml:"cachetune"`
+	MemoryTunes []MemoryTune `xml:"memorytune"`
+}
+
+// CacheTune is a cache allocation of the host, made through resctrl for a
+// set of virtual CPUs.
+type CacheTune struct {
+	VCPUs  string           `xml:"vcpus,attr"`
+	Caches []CacheTuneCache `xml:"cache"`
+}
+
+type CacheTuneCache struct {
+	ID    uint   `xml:"id,attr"`
+	Level uint   `xml:"level,attr"`
+	Type  string `xml:"type,attr"`
+	Size  uint64 `xml:"size,attr"`
+	Unit  string `xml:"unit,attr"`
+}
+
+// MemoryTune is a memory bandwidth allocation of the host, made through
+// resctrl for a set of virtual CPUs.
+type MemoryTune struct {
+	VCPUs string           `xml:"vcpus,attr"`
+	Nodes []MemoryTuneNode `xml:"node"`
+}
+
+type MemoryTuneNode struct {
+	ID        uint `xml:"id,attr"`
+	Bandwidth uint `xml:"bandwidth,attr"`
+}
+
+// unitSizes maps the units accepted by libvirt for sizes to their value in
+// bytes. Units are case insensitive.
+var unitSizes = map[string]uint64{
+	"":      1,
+	"b":     1,
+	"bytes": 1,
+	"kb":    1000,
+	"k":     1 << 10,
+	"kib":   1 << 10,
+	"mb":    1000 * 1000,
+	"m":     1 << 20,
+	"mib":   1 << 20,
+	"gb":    1000 * 1000 * 1000,
+	"g":     1 << 30,
+	"gib":   1 << 30,
+	"tb":    1000 * 1000 * 1000 * 1000,
+	"t":     1 << 40,
+	"tib":   1 << 40,
+	"pb":    1000 * 1000 * 1000 * 1000 * 1000,
+	"p":     1 << 50,
+	"pib":   1 << 50,
+	"eb":    1000 * 1000 * 1000 * 1000 * 1000 * 1000,
+	"e":     1 << 60,
+	"eib":   1 << 60,
+}
+
+// ScaledBytes converts a size expressed in a libvirt unit, such as "KiB" or
+// "MB", to bytes. An empty unit stands for bytes.
+func ScaledBytes(size uint64, unit string) (uint64, error) {
+	scale, ok := unitSizes[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+	return size * scale, nil
 }
 
 type Metadata struct {
 	// The actual xml tag is nova:instance, but we don't care about the namespaces
 	NovaInstance NovaInstance `xml:"instance"`
+	// Elements holds the other elements of the metadata, such as those
+	// set with 'virsh metadata'.
+	Elements []MetadataElement `xml:",any"`
+}
+
+// MetadataElement is an element of the metadata of a domain, whose
+// namespace identifies the application that set it.
+type MetadataElement struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
 }
 
 type NovaInstance struct {
@@ -30,51 +251,344 @@ type NovaInstance struct {
 	Owner  NovaOwner  `xml:"owner"`
 }
 
+// IsSet returns whether the domain is managed by OpenStack Nova, i.e.
+// whether its metadata contains a nova:instance element.
+func (n *NovaInstance) IsSet() bool {
+	return n.Name != "" || n.Owner.Project.ProjectId != ""
+}
+
 type NovaFlavor struct {
 	Name string `xml:"name,attr"`
 }
 
 type NovaOwner struct {
-	User        NovaUser    `xml:"user"`
-	Project     NovaProject `xml:"project"`
+	User    NovaUser    `xml:"user"`
+	Project NovaProject `xml:"project"`
 }
 
 type NovaUser struct {
-	UserId string `xml:"uuid,attr"`
+	UserId   string `xml:"uuid,attr"`
+	UserName string `xml:",chardata"`
 }
 
 type NovaProject struct {
-	ProjectId string `xml:"uuid,attr"`
+	ProjectId   string `xml:"uuid,attr"`
+	ProjectName string `xml:",chardata"`
 }
 
 type Devices struct {
-	Disks      []Disk      `xml:"disk"`
-	Interfaces []Interface `xml:"interface"`
+	Channels    []Channel    `xml:"channel"`
+	Controllers []Controller `xml:"controller"`
+	Disks       []Disk       `xml:"disk"`
+	Graphics    []Graphics   `xml:"graphics"`
+	Interfaces  []Interface  `xml:"interface"`
+	Shmems      []Shmem      `xml:"shmem"`
+	TPMs        []TPM        `xml:"tpm"`
+}
+
+type Controller struct {
+	Type  string `xml:"type,attr"`
+	Index string `xml:"index,attr"`
+	Model string `xml:"model,attr"`
+}
+
+// Graphics is a graphical console of a domain, such as a VNC or SPICE
+// server. Ports are -1 until they are allocated when autoport is enabled.
+type Graphics struct {
+	Type     string           `xml:"type,attr"`
+	Port     string           `xml:"port,attr"`
+	TLSPort  string           `xml:"tlsPort,attr"`
+	AutoPort string           `xml:"autoport,attr"`
+	Listen   string           `xml:"listen,attr"`
+	Listens  []GraphicsListen `xml:"listen"`
+}
+
+type GraphicsListen struct {
+	Type    string `xml:"type,attr"`
+	Address string `xml:"address,attr"`
+	Network string `xml:"network,attr"`
+	Socket  string `xml:"socket,attr"`
+}
+
+// ListensOnTCP returns whether the graphics server listens on TCP ports,
+// rather than on a UNIX socket or not at all.
+func (g *Graphics) ListensOnTCP() bool {
+	if len(g.Listens) == 0 {
+		return true
+	}
+	return g.Listens[0].Type == "address" || g.Listens[0].Type == "network"
+}
+
+// ListenAddress returns the address the graphics server listens on, which
+// is empty if it listens on the default address.
+func (g *Graphics) ListenAddress() string {
+	if len(g.Listens) > 0 && g.Listens[0].Address != "" {
+		return g.Listens[0].Address
+	}
+	return g.Listen
 }
 
 type Disk struct {
-	Device string     `xml:"device,attr"`
-	Source DiskSource `xml:"source"`
-	Target DiskTarget `xml:"target"`
+	Type       string      `xml:"type,attr"`
+	Device     string      `xml:"device,attr"`
+	Driver     DiskDriver  `xml:"driver"`
+	Source     DiskSource  `xml:"source"`
+	Target     DiskTarget  `xml:"target"`
+	Serial     string      `xml:"serial"`
+	Alias      Alias       `xml:"alias"`
+	Address    *Address    `xml:"address"`
+	Encryption *Encryption `xml:"encryption"`
+}
+
+// GetEncryption returns the encryption of a disk, which can be described
+// either directly in the disk or in its source, or nil if the disk is not
+// encrypted.
+func (d *Disk) GetEncryption() *Encryption {
+	if d.Source.Encryption != nil {
+		return d.Source.Encryption
+	}
+	return d.Encryption
+}
+
+// SourceName returns a name identifying the storage backing a disk,
+// whatever its type: the path of a file or block device, "<pool>/<volume>"
+// for storage volumes, or "<protocol>:<name>" for network disks, such as
+// "rbd:volumes/volume-1234". Network disks without a name, such as some
+// NBD disks, are identified by their first host instead.
+func (d *Disk) SourceName() string {
+	source := &d.Source
+	switch d.Type {
+	case "block":
+		return source.Dev
+	case "volume":
+		return source.Pool + "/" + source.Volume
+	case "network":
+		name := source.Name
+		if name == "" && len(source.Hosts) > 0 {
+			name = source.Hosts[0].String()
+		}
+		return source.Protocol + ":" + name
+	}
+	if source.File != "" {
+		return source.File
+	}
+	return source.Dev
+}
+
+type DiskDriver struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
 }
 
 type DiskSource struct {
-	File string `xml:"file,attr"`
+	File          string           `xml:"file,attr"`
+	Dev           string           `xml:"dev,attr"`
+	Pool          string           `xml:"pool,attr"`
+	Volume        string           `xml:"volume,attr"`
+	Protocol      string           `xml:"protocol,attr"`
+	Name          string           `xml:"name,attr"`
+	Index         string           `xml:"index,attr"`
+	Hosts         []DiskSourceHost `xml:"host"`
+	Encryption    *Encryption      `xml:"encryption"`
+	OtherAttrs    []xml.Attr       `xml:",any,attr"`
+	OtherElements []AnyElement     `xml:",any"`
+}
+
+type DiskSourceHost struct {
+	Name   string `xml:"name,attr"`
+	Port   string `xml:"port,attr"`
+	Socket string `xml:"socket,attr"`
+}
+
+// String returns the address of the host, as "<name>:<port>", or the path
+// of its socket for UNIX socket transports.
+func (h *DiskSourceHost) String() string {
+	if h.Socket != "" {
+		return h.Socket
+	}
+	if h.Port == "" {
+		return h.Name
+	}
+	return net.JoinHostPort(h.Name, h.Port)
+}
+
+type Encryption struct {
+	Format string `xml:"format,attr"`
+	Engine string `xml:"engine,attr"`
+}
+
+type Alias struct {
+	Name string `xml:"name,attr"`
 }
 
 type DiskTarget struct {
 	Device string `xml:"dev,attr"`
+	Bus    string `xml:"bus,attr"`
+}
+
+// Address is the address of a device on its controller. Only the
+// controller of drive addresses is kept.
+type Address struct {
+	Type       string `xml:"type,attr"`
+	Controller string `xml:"controller,attr"`
 }
 
 type Interface struct {
-	Source InterfaceSource `xml:"source"`
-	Target InterfaceTarget `xml:"target"`
+	Type      string          `xml:"type,attr"`
+	Model     InterfaceModel  `xml:"model"`
+	Source    InterfaceSource `xml:"source"`
+	Target    InterfaceTarget `xml:"target"`
+	FilterRef *FilterRef      `xml:"filterref"`
+	MTU       *InterfaceMTU   `xml:"mtu"`
 }
 
 type InterfaceSource struct {
-	Bridge string `xml:"bridge,attr"`
+	Bridge        string       `xml:"bridge,attr"`
+	Network       string       `xml:"network,attr"`
+	PortID        string       `xml:"portid,attr"`
+	OtherAttrs    []xml.Attr   `xml:",any,attr"`
+	OtherElements []AnyElement `xml:",any"`
+}
+
+type InterfaceModel struct {
+	Type string `xml:"type,attr"`
+}
+
+type InterfaceMTU struct {
+	Size uint `xml:"size,attr"`
 }
 
 type InterfaceTarget struct {
 	Device string `xml:"dev,attr"`
 }
+
+// FilterRef references a network filter, from an interface or from
+// another filter.
+type FilterRef struct {
+	Filter string `xml:"filter,attr"`
+}
+
+type Channel struct {
+	Type   string        `xml:"type,attr"`
+	Target ChannelTarget `xml:"target"`
+}
+
+type ChannelTarget struct {
+	Type string `xml:"type,attr"`
+	Name string `xml:"name,attr"`
+	// State is only present in the XML description of running domains,
+	// for virtio channels.
+	State string `xml:"state,attr"`
+}
+
+// Shmem is a shared memory device, such as an ivshmem device.
+type Shmem struct {
+	Name  string     `xml:"name,attr"`
+	Model ShmemModel `xml:"model"`
+	Size  *ShmemSize `xml:"size"`
+}
+
+type ShmemModel struct {
+	Type string `xml:"type,attr"`
+}
+
+type ShmemSize struct {
+	Unit  string `xml:"unit,attr"`
+	Value uint64 `xml:",chardata"`
+}
+
+type TPM struct {
+	Model   string     `xml:"model,attr"`
+	Backend TPMBackend `xml:"backend"`
+}
+
+type TPMBackend struct {
+	Type    string `xml:"type,attr"`
+	Version string `xml:"version,attr"`
+}
+
+// Sysinfo is the host sysinfo XML, as returned by virConnectGetSysinfo().
+type Sysinfo struct {
+	BIOS   SysinfoEntries `xml:"bios"`
+	System SysinfoEntries `xml:"system"`
+}
+
+type SysinfoEntries struct {
+	Entries []SysinfoEntry `xml:"entry"`
+}
+
+type SysinfoEntry struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Get returns the value of the entry with the given name, or an empty
+// string if there is no such entry.
+func (e *SysinfoEntries) Get(name string) string {
+	for _, entry := range e.Entries {
+		if entry.Name == name {
+			return entry.Value
+		}
+	}
+	return ""
+}
+
+// StoragePool is the XML description of a storage pool, as returned by
+// virStoragePoolGetXMLDesc().
+type StoragePool struct {
+	Type string `xml:"type,attr"`
+}
+
+// DomainCheckpoint is the XML description of a checkpoint of a domain, as
+// returned by virDomainCheckpointGetXMLDesc().
+type DomainCheckpoint struct {
+	Name         string `xml:"name"`
+	CreationTime int64  `xml:"creationTime"`
+}
+
+// NWFilter is the XML description of a network filter, as returned by
+// virNWFilterGetXMLDesc().
+type NWFilter struct {
+	Name       string         `xml:"name,attr"`
+	Rules      []NWFilterRule `xml:"rule"`
+	FilterRefs []FilterRef    `xml:"filterref"`
+}
+
+type NWFilterRule struct {
+	Action    string `xml:"action,attr"`
+	Direction string `xml:"direction,attr"`
+}
+
+// AnyElement captures the name of an element that is not part of this
+// schema.
+type AnyElement struct {
+	XMLName xml.Name
+}
+
+// UnknownFields returns the attributes and elements that were found in
+// the parts of the domain XML used to derive labels, but that are not
+// understood by this schema. Entries are of the form "disk/source@unknown"
+// for attributes and "interface/source/reservation" for elements. The
+// result is sorted and may contain duplicates if multiple devices have
+// the same unknown field.
+func (d *Domain) UnknownFields() []string {
+	var fields []string
+	for _, disk := range d.Devices.Disks {
+		fields = appendUnknown(fields, "disk/source", disk.Source.OtherAttrs, disk.Source.OtherElements)
+	}
+	for _, iface := range d.Devices.Interfaces {
+		fields = appendUnknown(fields, "interface/source", iface.Source.OtherAttrs, iface.Source.OtherElements)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func appendUnknown(fields []string, path string, attrs []xml.Attr, elements []AnyElement) []string {
+	for _, attr := range attrs {
+		fields = append(fields, path+"@"+attr.Name.Local)
+	}
+	for _, element := range elements {
+		fields = append(fields, path+"/"+element.XMLName.Local)
+	}
+	return fields
+}